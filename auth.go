@@ -0,0 +1,233 @@
+package gohc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider gives credentials to add to health check requests as headers (metadata for gRPC).
+// It is called before each request, implementations must be safe for concurrent use.
+type AuthProvider interface {
+	AuthHeaders(ctx context.Context) (http.Header, error)
+}
+
+// RequestSigner signs an http request just before it is sent (e.g.: AWS SigV4 style signing),
+// body is the payload sent with request (nil if none).
+type RequestSigner interface {
+	SignRequest(req *http.Request, body []byte) error
+}
+
+// RequestSignerFunc is a function implementing RequestSigner.
+type RequestSignerFunc func(req *http.Request, body []byte) error
+
+func (f RequestSignerFunc) SignRequest(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// BasicAuth gives an Authorization header with basic authentication.
+type BasicAuth struct {
+	User     string
+	Password string
+}
+
+func (a *BasicAuth) AuthHeaders(ctx context.Context) (http.Header, error) {
+	credentials := base64.StdEncoding.EncodeToString([]byte(a.User + ":" + a.Password))
+	return http.Header{
+		"Authorization": []string{"Basic " + credentials},
+	}, nil
+}
+
+// BearerTokenFile gives an Authorization header with a bearer token read from a file,
+// file is read again only when modified (e.g.: kubernetes service account token).
+type BearerTokenFile struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	token   string
+}
+
+func NewBearerTokenFile(path string) *BearerTokenFile {
+	return &BearerTokenFile{
+		path: path,
+	}
+}
+
+func (a *BearerTokenFile) AuthHeaders(ctx context.Context) (http.Header, error) {
+	token, err := a.loadToken()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{
+		"Authorization": []string{"Bearer " + token},
+	}, nil
+}
+
+func (a *BearerTokenFile) loadToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return "", fmt.Errorf("fail to read bearer token file: %w", err)
+	}
+	if a.token != "" && info.ModTime().Equal(a.modTime) {
+		return a.token, nil
+	}
+	b, err := os.ReadFile(a.path)
+	if err != nil {
+		return "", fmt.Errorf("fail to read bearer token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("bearer token file %s is empty", a.path)
+	}
+	a.modTime = info.ModTime()
+	a.token = token
+	return token, nil
+}
+
+// OAuth2ClientCredentialsOpt Describes how to retrieve a token with OAuth2 client credentials grant.
+type OAuth2ClientCredentialsOpt struct {
+	// TokenUrl url of the token endpoint
+	TokenUrl string
+	// ClientId of the client
+	ClientId string
+	// ClientSecret of the client
+	ClientSecret string
+	// Scopes to request
+	Scopes []string
+	// EndpointParams additional parameters sent to token endpoint (e.g.: audience)
+	EndpointParams url.Values
+	// Timeout for token request. If left empty (default to 5s)
+	Timeout time.Duration
+	// TlsConfig specifies the TLS configuration to use to reach token endpoint.
+	TlsConfig *tls.Config
+	// ExpiryDelta token is refreshed this duration before its expiration. If left empty (default to 10s)
+	ExpiryDelta time.Duration
+}
+
+// OAuth2ClientCredentials gives an Authorization header with a bearer token retrieved with OAuth2
+// client credentials grant, token is cached and refreshed when it is about to expire.
+type OAuth2ClientCredentials struct {
+	opt        *OAuth2ClientCredentialsOpt
+	httpClient *http.Client
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+}
+
+func NewOAuth2ClientCredentials(opt *OAuth2ClientCredentialsOpt) *OAuth2ClientCredentials {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = opt.TlsConfig
+	return &OAuth2ClientCredentials{
+		opt: opt,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+	}
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (a *OAuth2ClientCredentials) AuthHeaders(ctx context.Context) (http.Header, error) {
+	token, err := a.loadToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return http.Header{
+		"Authorization": []string{"Bearer " + token},
+	}, nil
+}
+
+func (a *OAuth2ClientCredentials) loadToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	expiryDelta := a.opt.ExpiryDelta
+	if expiryDelta == 0 {
+		expiryDelta = 10 * time.Second
+	}
+	if a.token != "" && (a.expiry.IsZero() || time.Now().Add(expiryDelta).Before(a.expiry)) {
+		return a.token, nil
+	}
+
+	params := url.Values{}
+	for key, values := range a.opt.EndpointParams {
+		params[key] = values
+	}
+	params.Set("grant_type", "client_credentials")
+	if len(a.opt.Scopes) > 0 {
+		params.Set("scope", strings.Join(a.opt.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.opt.TokenUrl, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(a.opt.ClientId), url.QueryEscape(a.opt.ClientSecret))
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fail to retrieve oauth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("fail to retrieve oauth2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fail to retrieve oauth2 token: token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	var tokenResp oauth2TokenResponse
+	err = json.Unmarshal(b, &tokenResp)
+	if err != nil {
+		return "", fmt.Errorf("fail to decode oauth2 token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("no access token in oauth2 token response")
+	}
+	a.token = tokenResp.AccessToken
+	a.expiry = time.Time{}
+	if tokenResp.ExpiresIn > 0 {
+		a.expiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return a.token, nil
+}
+
+// grpcAuthCredentials adapts an AuthProvider to grpc per rpc credentials
+type grpcAuthCredentials struct {
+	provider AuthProvider
+}
+
+func (c *grpcAuthCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	headers, err := c.provider.AuthHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	md := make(map[string]string, len(headers))
+	for key, values := range headers {
+		md[strings.ToLower(key)] = strings.Join(values, ", ")
+	}
+	return md, nil
+}
+
+func (c *grpcAuthCredentials) RequireTransportSecurity() bool {
+	return false
+}
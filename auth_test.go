@@ -0,0 +1,232 @@
+package gohc_test
+
+import (
+	"context"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Auth", func() {
+	var server *ghttp.Server
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Context("BasicAuth", func() {
+		It("should send basic auth header", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyBasicAuth("user", "pass"),
+				ghttp.RespondWith(200, "OK"),
+			))
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: &BasicAuth{User: "user", Password: "pass"},
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+		})
+		It("should not modify headers given by user", func() {
+			server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+			headers := http.Header{"X-Test": []string{"test"}}
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Headers: headers,
+				Auth:    &BasicAuth{User: "user", Password: "pass"},
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+			Expect(headers).To(HaveLen(1))
+		})
+	})
+	Context("BearerTokenFile", func() {
+		It("should reload token when file changes", func() {
+			tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+			Expect(os.WriteFile(tokenFile, []byte("token1\n"), 0600)).To(Succeed())
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token1"),
+					ghttp.RespondWith(200, "OK"),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token2"),
+					ghttp.RespondWith(200, "OK"),
+				),
+			)
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: NewBearerTokenFile(tokenFile),
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+
+			Expect(os.WriteFile(tokenFile, []byte("token2"), 0600)).To(Succeed())
+			Expect(os.Chtimes(tokenFile, time.Now(), time.Now().Add(time.Minute))).To(Succeed())
+			err = hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+		})
+		It("should return an error when file does not exist", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: NewBearerTokenFile(filepath.Join(GinkgoT().TempDir(), "token")),
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("fail to get credentials"))
+		})
+	})
+	Context("OAuth2ClientCredentials", func() {
+		var tokenServer *ghttp.Server
+		BeforeEach(func() {
+			tokenServer = ghttp.NewServer()
+		})
+		AfterEach(func() {
+			tokenServer.Close()
+		})
+		It("should retrieve token and cache it until expiration", func() {
+			tokenServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/token"),
+					ghttp.VerifyBasicAuth("client", "secret"),
+					ghttp.VerifyForm(map[string][]string{
+						"grant_type": {"client_credentials"},
+						"scope":      {"read write"},
+					}),
+					ghttp.RespondWith(200, `{"access_token": "token1", "token_type": "bearer", "expires_in": 3600}`),
+				),
+			)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token1"),
+					ghttp.RespondWith(200, "OK"),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token1"),
+					ghttp.RespondWith(200, "OK"),
+				),
+			)
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: NewOAuth2ClientCredentials(&OAuth2ClientCredentialsOpt{
+					TokenUrl:     tokenServer.URL() + "/token",
+					ClientId:     "client",
+					ClientSecret: "secret",
+					Scopes:       []string{"read", "write"},
+				}),
+			})
+
+			Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+			Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+			Expect(tokenServer.ReceivedRequests()).To(HaveLen(1))
+		})
+		It("should refresh token when it is about to expire", func() {
+			tokenServer.AppendHandlers(
+				ghttp.RespondWith(200, `{"access_token": "token1", "expires_in": 5}`),
+				ghttp.RespondWith(200, `{"access_token": "token2", "expires_in": 3600}`),
+			)
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token1"),
+					ghttp.RespondWith(200, "OK"),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token2"),
+					ghttp.RespondWith(200, "OK"),
+				),
+			)
+			// token expiring in 5s is always in refresh window of 10s
+			auth := NewOAuth2ClientCredentials(&OAuth2ClientCredentialsOpt{
+				TokenUrl: tokenServer.URL(),
+			})
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: auth,
+			})
+
+			Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+			Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+			Expect(tokenServer.ReceivedRequests()).To(HaveLen(2))
+		})
+		It("should return an error when token endpoint fails", func() {
+			tokenServer.AppendHandlers(ghttp.RespondWith(401, `{"error": "invalid_client"}`))
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Auth: NewOAuth2ClientCredentials(&OAuth2ClientCredentialsOpt{
+					TokenUrl: tokenServer.URL(),
+				}),
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("invalid_client"))
+		})
+	})
+	Context("RequestSigner", func() {
+		It("should sign request with body", func() {
+			server.AppendHandlers(ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("X-Signature", "POST /signed test"),
+				ghttp.RespondWith(200, "OK"),
+			))
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Path:   "/signed",
+				Method: "POST",
+				Send:   &Payload{Text: "test"},
+				Signer: RequestSignerFunc(func(req *http.Request, body []byte) error {
+					req.Header.Set("X-Signature", req.Method+" "+req.URL.Path+" "+string(body))
+					return nil
+				}),
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+		})
+	})
+	Context("Grpc", func() {
+		var grpcServer *grpc.Server
+		var lis net.Listener
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("tcp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			grpcServer = grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				if len(md.Get("authorization")) == 0 || md.Get("authorization")[0] != "Basic dXNlcjpwYXNz" {
+					return nil, status.Error(codes.Unauthenticated, "bad credentials")
+				}
+				return handler(ctx, req)
+			}))
+			healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+			go grpcServer.Serve(lis)
+		})
+		AfterEach(func() {
+			grpcServer.Stop()
+			lis.Close()
+		})
+		It("should send credentials as metadata", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Auth: &BasicAuth{User: "user", Password: "pass"},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should return an error without credentials", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("Unauthenticated"))
+		})
+	})
+})
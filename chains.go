@@ -19,6 +19,28 @@ func NewChains(inParallel bool, requireAll bool, hcs ...HealthChecker) *Chains {
 	}
 }
 
+// NonCritical wraps a health check to mark it as non-critical in Chains,
+// any failure of this health check is returned as a WarnError.
+func NonCritical(hc HealthChecker) HealthChecker {
+	return &nonCriticalHealthCheck{hc: hc}
+}
+
+type nonCriticalHealthCheck struct {
+	hc HealthChecker
+}
+
+func (h *nonCriticalHealthCheck) Check(host string) error {
+	err := h.hc.Check(host)
+	if err == nil || IsWarning(err) {
+		return err
+	}
+	return &WarnError{Err: err}
+}
+
+func (h *nonCriticalHealthCheck) String() string {
+	return fmt.Sprintf("%v (non-critical)", h.hc)
+}
+
 func (c *Chains) Check(host string) error {
 	if len(c.hcs) == 0 {
 		return nil
@@ -31,6 +53,7 @@ func (c *Chains) Check(host string) error {
 
 func (c *Chains) checkInSeries(host string) error {
 	var resultErr string
+	var resultWarn string
 	oneSucceed := false
 	for _, hc := range c.hcs {
 		err := hc.Check(host)
@@ -38,6 +61,11 @@ func (c *Chains) checkInSeries(host string) error {
 			oneSucceed = true
 			continue
 		}
+		if IsWarning(err) {
+			oneSucceed = true
+			resultWarn = fmt.Sprintf("%s- %v: %s\n", resultWarn, hc, warnMessage(err))
+			continue
+		}
 		if err != nil && c.requireAll {
 			return fmt.Errorf("error on healthcheck '%v' for host '%s' : %w", hc, host, err)
 		}
@@ -48,6 +76,9 @@ func (c *Chains) checkInSeries(host string) error {
 	if !oneSucceed {
 		return fmt.Errorf("errors on healthchecks for host '%s':\n%s", host, resultErr)
 	}
+	if resultWarn != "" {
+		return NewWarnError("warnings on healthchecks for host '%s':\n%s", host, resultWarn)
+	}
 	return nil
 }
 
@@ -60,17 +91,26 @@ func (c *Chains) checkInParallel(host string) error {
 			defer wg.Done()
 
 			err := hc.Check(host)
+			if IsWarning(err) {
+				errCh <- &WarnError{Err: fmt.Errorf("%v: %s", hc, warnMessage(err))}
+				return
+			}
 			if err != nil {
 				errCh <- fmt.Errorf("%v: %w", hc, err)
 			}
 		}(host, hc)
 	}
 	var resultErr string
+	var resultWarn string
 	done := make(chan struct{})
 	nbErrors := 0
 	go func() {
 		defer close(done)
 		for err := range errCh {
+			if IsWarning(err) {
+				resultWarn = resultWarn + "- " + warnMessage(err) + "\n"
+				continue
+			}
 			nbErrors++
 			resultErr = resultErr + "- " + err.Error() + "\n"
 		}
@@ -81,5 +121,8 @@ func (c *Chains) checkInParallel(host string) error {
 	if resultErr != "" && (c.requireAll || nbErrors == len(c.hcs)) {
 		return fmt.Errorf("errors on healthchecks for host '%s':\n%s", host, resultErr)
 	}
+	if resultWarn != "" {
+		return NewWarnError("warnings on healthchecks for host '%s':\n%s", host, resultWarn)
+	}
 	return nil
 }
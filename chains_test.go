@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"net"
+	"strings"
 
 	"github.com/ArthurHlt/gohc"
 )
@@ -74,6 +75,35 @@ var _ = Describe("Chains", func() {
 				})
 			})
 		})
+		Context("Non critical", func() {
+			It("should return a warning in serial when non critical check fail", func() {
+				hc := gohc.NewChains(false, true, NewTestHealthCheck(), gohc.NonCritical(NewTestHealthCheckErr()))
+
+				err := hc.Check(lis.Addr().String())
+
+				Expect(err).ToNot(BeNil())
+				Expect(gohc.IsWarning(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("non-critical"))
+				Expect(strings.Count(err.Error(), "warning:")).To(Equal(1))
+			})
+			It("should return a warning in parallel when non critical check fail", func() {
+				hc := gohc.NewChains(true, true, NewTestHealthCheck(), gohc.NonCritical(NewTestHealthCheckErr()))
+
+				err := hc.Check(lis.Addr().String())
+
+				Expect(err).ToNot(BeNil())
+				Expect(gohc.IsWarning(err)).To(BeTrue())
+				Expect(strings.Count(err.Error(), "warning:")).To(Equal(1))
+			})
+			It("should return a failure when a critical check fail", func() {
+				hc := gohc.NewChains(true, true, NewTestHealthCheckErr(), gohc.NonCritical(NewTestHealthCheckErr()))
+
+				err := hc.Check(lis.Addr().String())
+
+				Expect(err).ToNot(BeNil())
+				Expect(gohc.IsWarning(err)).To(BeFalse())
+			})
+		})
 		Context("Parallel", func() {
 			When("Without requiring all check passing", func() {
 				It("should return nil when none fail", func() {
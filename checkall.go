@@ -0,0 +1,195 @@
+package gohc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	FailureClassTimeout           = "timeout"
+	FailureClassConnectionRefused = "connection_refused"
+	FailureClassDns               = "dns"
+	FailureClassTls               = "tls"
+	FailureClassCanceled          = "canceled"
+	FailureClassCheck             = "check_failed"
+)
+
+// CheckAllOpt Describes how CheckAll fan-out checks over hosts.
+type CheckAllOpt struct {
+	// Concurrency max number of checks running at the same time. If left empty (default to 10)
+	Concurrency int
+	// HostsPerSecond max number of hosts checks started per second.
+	// If left empty, negative or too high to be paced by nanoseconds there is no limit.
+	HostsPerSecond float64
+	// OnResult if set, is called as soon as a host check finished (not in the hosts order).
+	// It is called from a single goroutine at a time.
+	OnResult func(result *HostResult)
+}
+
+// HostResult is the result of a health check for one host.
+type HostResult struct {
+	// Index of the host in the hosts list given to CheckAll
+	Index    int
+	Host     string
+	Status   HealthStatus
+	Err      error
+	Duration time.Duration
+}
+
+// CheckAllSummary gives results of all hosts in the same order as given hosts and counters.
+type CheckAllSummary struct {
+	Results []*HostResult
+	Healthy int
+	Warning int
+	Failed  int
+	// FailureClasses number of failed hosts by failure class (see ClassifyError)
+	FailureClasses map[string]int
+}
+
+// CheckAll runs checker on every hosts with bounded concurrency.
+// The same checker is used for all hosts so that checker which keep clients (like HttpHealthCheck)
+// reuse their connection pool, checker must so be safe for concurrent use which is the case for all
+// checkers of this library.
+// When ctx is done, hosts not yet checked are reported as failed with the context error.
+func CheckAll(ctx context.Context, checker HealthChecker, hosts []string, opt *CheckAllOpt) *CheckAllSummary {
+	if opt == nil {
+		opt = &CheckAllOpt{}
+	}
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	summary := &CheckAllSummary{
+		Results:        make([]*HostResult, len(hosts)),
+		FailureClasses: make(map[string]int),
+	}
+
+	resultCh := make(chan *HostResult)
+	indexCh := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexCh {
+				resultCh <- checkHost(checker, index, hosts[index])
+			}
+		}()
+	}
+
+	go func() {
+		defer close(indexCh)
+		var ticker *time.Ticker
+		if interval := rateInterval(opt.HostsPerSecond); interval > 0 {
+			ticker = time.NewTicker(interval)
+			defer ticker.Stop()
+		}
+		for index, host := range hosts {
+			if ticker != nil && index > 0 {
+				select {
+				case <-ctx.Done():
+				case <-ticker.C:
+				}
+			}
+			if ctx.Err() != nil {
+				resultCh <- canceledHostResult(ctx, index, host)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				resultCh <- canceledHostResult(ctx, index, host)
+			case indexCh <- index:
+			}
+		}
+	}()
+
+	for range hosts {
+		result := <-resultCh
+		summary.Results[result.Index] = result
+		switch result.Status {
+		case HealthStatusPass:
+			summary.Healthy++
+		case HealthStatusWarn:
+			summary.Warning++
+		default:
+			summary.Failed++
+			summary.FailureClasses[ClassifyError(result.Err)]++
+		}
+		if opt.OnResult != nil {
+			opt.OnResult(result)
+		}
+	}
+	wg.Wait()
+	return summary
+}
+
+func checkHost(checker HealthChecker, index int, host string) *HostResult {
+	start := time.Now()
+	err := checker.Check(host)
+	return &HostResult{
+		Index:    index,
+		Host:     host,
+		Status:   StatusFromError(err),
+		Err:      err,
+		Duration: time.Since(start),
+	}
+}
+
+// rateInterval gives interval between hosts checks started, 0 if rate is not limited
+func rateInterval(hostsPerSecond float64) time.Duration {
+	// NaN and negative rates are not limited, +Inf and too high rates give an interval rounded to 0
+	if !(hostsPerSecond > 0) {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / hostsPerSecond)
+}
+
+func canceledHostResult(ctx context.Context, index int, host string) *HostResult {
+	return &HostResult{
+		Index:  index,
+		Host:   host,
+		Status: HealthStatusFail,
+		Err:    ctx.Err(),
+	}
+}
+
+// ClassifyError gives a failure class for an error returned by a health check.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return FailureClassCanceled
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return FailureClassDns
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return FailureClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return FailureClassTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return FailureClassConnectionRefused
+	}
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &certErr) || errors.As(err, &unknownAuthErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &certInvalidErr) {
+		return FailureClassTls
+	}
+	return FailureClassCheck
+}
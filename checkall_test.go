@@ -0,0 +1,89 @@
+package gohc_test
+
+import (
+	"context"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"math"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("CheckAll", func() {
+	var lis net.Listener
+	var closedHost string
+	BeforeEach(func() {
+		var err error
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		closedLis, err := net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		closedHost = closedLis.Addr().String()
+		closedLis.Close()
+	})
+	AfterEach(func() {
+		lis.Close()
+	})
+	It("should return ordered results and summary", func() {
+		hosts := []string{lis.Addr().String(), closedHost, lis.Addr().String()}
+
+		summary := CheckAll(context.Background(), NewTcpHealthCheck(&TcpOpt{}), hosts, &CheckAllOpt{
+			Concurrency: 2,
+		})
+
+		Expect(summary.Results).To(HaveLen(3))
+		for i, result := range summary.Results {
+			Expect(result.Index).To(Equal(i))
+			Expect(result.Host).To(Equal(hosts[i]))
+		}
+		Expect(summary.Results[1].Err).ToNot(BeNil())
+		Expect(summary.Healthy).To(Equal(2))
+		Expect(summary.Failed).To(Equal(1))
+		Expect(summary.FailureClasses).To(HaveKeyWithValue(FailureClassConnectionRefused, 1))
+	})
+	It("should stream results and count warnings", func() {
+		var nbResults int64
+		hosts := []string{"127.0.0.1:1", "127.0.0.1:2"}
+
+		summary := CheckAll(context.Background(), NonCritical(NewTestHealthCheckErr()), hosts, &CheckAllOpt{
+			OnResult: func(result *HostResult) {
+				atomic.AddInt64(&nbResults, 1)
+			},
+		})
+
+		Expect(nbResults).To(Equal(int64(2)))
+		Expect(summary.Warning).To(Equal(2))
+	})
+	It("should rate limit hosts checks", func() {
+		hosts := []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}
+
+		start := time.Now()
+		summary := CheckAll(context.Background(), NewTestHealthCheck(), hosts, &CheckAllOpt{
+			HostsPerSecond: 50,
+		})
+
+		Expect(time.Since(start)).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(summary.Healthy).To(Equal(3))
+	})
+	It("should not rate limit when rate is invalid or too high to be paced", func() {
+		hosts := []string{"127.0.0.1:1", "127.0.0.1:2"}
+
+		for _, hostsPerSecond := range []float64{-1, math.NaN(), 2e9, math.Inf(1)} {
+			summary := CheckAll(context.Background(), NewTestHealthCheck(), hosts, &CheckAllOpt{
+				HostsPerSecond: hostsPerSecond,
+			})
+			Expect(summary.Healthy).To(Equal(2))
+		}
+	})
+	It("should report not checked hosts as canceled when context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		summary := CheckAll(ctx, NewTestHealthCheck(), []string{"127.0.0.1:1", "127.0.0.1:2"}, nil)
+
+		Expect(summary.Failed).To(Equal(2))
+		Expect(summary.FailureClasses).To(HaveKeyWithValue(FailureClassCanceled, 2))
+	})
+})
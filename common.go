@@ -1,11 +1,22 @@
 package gohc
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 )
 
+// UnixHostPrefix prefix of hosts targeting a unix domain socket (e.g.: unix:///var/run/app/health.sock),
+// on linux an abstract socket can be targeted by starting its name with @ (e.g.: unix://@app/health).
+const UnixHostPrefix = "unix://"
+
+// FormatHost sets altPort on host if set, unix hosts are returned as is.
 func FormatHost(host string, altPort uint32) (string, error) {
+	if IsUnixHost(host) {
+		return host, nil
+	}
 	splitHost, port, err := net.SplitHostPort(host)
 	if err != nil {
 		return "", fmt.Errorf("fail to split host and port: %w", err)
@@ -16,6 +27,109 @@ func FormatHost(host string, altPort uint32) (string, error) {
 	return net.JoinHostPort(splitHost, port), nil
 }
 
+// IsUnixHost returns true if host targets a unix domain socket.
+func IsUnixHost(host string) bool {
+	return strings.HasPrefix(host, UnixHostPrefix)
+}
+
+// dialTarget gives network and address to dial for host.
+func dialTarget(host string) (network string, address string) {
+	if IsUnixHost(host) {
+		return "unix", strings.TrimPrefix(host, UnixHostPrefix)
+	}
+	return "tcp", host
+}
+
+// defaultServerName gives tls server name for host when not set, localhost for unix socket hosts
+// as for http Host header.
+func defaultServerName(host string) string {
+	if IsUnixHost(host) {
+		return "localhost"
+	}
+	serverName, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	return serverName
+}
+
+// readUntilContains reads from reader until data contains expected or reader is exhausted.
+func readUntilContains(reader io.Reader, expected []byte) ([]byte, error) {
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			// only search in new data and the end of previous one which could contain the beginning of expected
+			searchStart := len(data) - len(expected) + 1
+			if searchStart < 0 {
+				searchStart = 0
+			}
+			data = append(data, buf[:n]...)
+			if bytes.Contains(data[searchStart:], expected) {
+				return data, nil
+			}
+		}
+		if err == io.EOF {
+			return data, nil
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+}
+
+// defaultMaxReceiveBytes is the default limit of data buffered to find received payloads.
+const defaultMaxReceiveBytes = 64 * 1024
+
+// receiveMatcher finds payloads blocks in received data, each block must be found and in the order specified,
+// but not necessarily contiguous.
+type receiveMatcher struct {
+	blocks [][]byte
+	// index of next block to find
+	next int
+	// position in data after the last block found
+	offset int
+	data   []byte
+}
+
+func newReceiveMatcher(payloads []*Payload) *receiveMatcher {
+	blocks := make([][]byte, len(payloads))
+	for i, payload := range payloads {
+		blocks[i] = payload.GetData()
+	}
+	return &receiveMatcher{
+		blocks: blocks,
+	}
+}
+
+// feed adds received data and returns true when all blocks have been found.
+func (m *receiveMatcher) feed(b []byte) bool {
+	m.data = append(m.data, b...)
+	for m.next < len(m.blocks) {
+		idx := bytes.Index(m.data[m.offset:], m.blocks[m.next])
+		if idx == -1 {
+			return false
+		}
+		m.offset += idx + len(m.blocks[m.next])
+		m.next++
+	}
+	return true
+}
+
+func (m *receiveMatcher) done() bool {
+	return m.next >= len(m.blocks)
+}
+
+func (m *receiveMatcher) err(cause error) error {
+	if cause != nil {
+		return fmt.Errorf("expected %s (block %d/%d) in received data, got %s: %v",
+			string(m.blocks[m.next]), m.next+1, len(m.blocks), string(m.data), cause)
+	}
+	return fmt.Errorf("expected %s (block %d/%d) in received data, got %s",
+		string(m.blocks[m.next]), m.next+1, len(m.blocks), string(m.data))
+}
+
 // IntRange Specifies the int64 start and end of the range using half-open interval semantics [start,
 // end).
 type IntRange struct {
@@ -25,6 +139,31 @@ type IntRange struct {
 	End int64
 }
 
+func (r *IntRange) Contains(value int64) bool {
+	return value >= r.Start && value < r.End
+}
+
+func (r *IntRange) String() string {
+	return fmt.Sprintf("[%d, %d)", r.Start, r.End)
+}
+
+func intRangesContains(ranges []*IntRange, value int64) bool {
+	for _, r := range ranges {
+		if r.Contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func intRangesString(ranges []*IntRange) string {
+	rangesStr := make([]string, len(ranges))
+	for i, r := range ranges {
+		rangesStr[i] = r.String()
+	}
+	return strings.Join(rangesStr, ", ")
+}
+
 // Payload Describes the encoding of the payload bytes in the payload.
 // It can be either text or binary.
 type Payload struct {
@@ -0,0 +1,294 @@
+package gohc
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsulCheck is a health check converted from a consul check definition.
+type ConsulCheck struct {
+	// ServiceName name of the service which declares the check, empty for checks declared outside a service.
+	ServiceName string
+	// ID of the check if set in definition
+	ID string
+	// Name of the check if set in definition
+	Name string
+	// Interval between checks as set in definition
+	Interval time.Duration
+	// Host to give to health checker during check
+	Host string
+	// HealthChecker converted from definition
+	HealthChecker HealthChecker
+}
+
+// LoadConsulDefinition reads a consul service definition file, see ParseConsulDefinition.
+func LoadConsulDefinition(path string) ([]*ConsulCheck, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseConsulDefinition(f)
+}
+
+// ParseConsulDefinition converts checks from a consul service definition in json (or HCL converted to json)
+// to health checkers. Definition can contain a `service`, a list of `services`, or `check`/`checks` directly.
+// Keys can be written in snake case (tls_skip_verify) or camel case (TLSSkipVerify).
+// Supported check types are http, tcp, udp, grpc and args (script), other types return an error.
+func ParseConsulDefinition(r io.Reader) ([]*ConsulCheck, error) {
+	var raw any
+	err := json.NewDecoder(r).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode consul definition: %w", err)
+	}
+	root := normalizeConsulKeys(raw)
+	var consulChecks []*ConsulCheck
+	for _, def := range consulObjects(root) {
+		services := append(consulObjects(def["service"]), consulObjects(def["services"])...)
+		// definition can be directly a service
+		isService := len(services) == 0 && def["name"] != nil
+		if isService {
+			services = consulObjects(def)
+		}
+		for _, service := range services {
+			checks, err := parseConsulServiceChecks(service)
+			if err != nil {
+				return nil, err
+			}
+			consulChecks = append(consulChecks, checks...)
+		}
+		if isService {
+			continue
+		}
+		for _, checkDef := range append(consulObjects(def["check"]), consulObjects(def["checks"])...) {
+			check, err := parseConsulCheck(checkDef, "", "")
+			if err != nil {
+				return nil, err
+			}
+			consulChecks = append(consulChecks, check)
+		}
+	}
+	return consulChecks, nil
+}
+
+func parseConsulServiceChecks(service map[string]any) ([]*ConsulCheck, error) {
+	serviceName := consulString(service["name"])
+	address := consulString(service["address"])
+	if address == "" {
+		address = "127.0.0.1"
+	}
+	serviceHost := net.JoinHostPort(address, strconv.Itoa(int(consulInt(service["port"]))))
+	var checks []*ConsulCheck
+	for _, checkDef := range append(consulObjects(service["check"]), consulObjects(service["checks"])...) {
+		check, err := parseConsulCheck(checkDef, serviceName, serviceHost)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func parseConsulCheck(def map[string]any, serviceName, serviceHost string) (*ConsulCheck, error) {
+	check := &ConsulCheck{
+		ServiceName: serviceName,
+		ID:          consulString(def["id"]),
+		Name:        consulString(def["name"]),
+	}
+	var err error
+	check.Interval, err = consulDuration(def["interval"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval for check '%s': %w", check.Name, err)
+	}
+	timeout, err := consulDuration(def["timeout"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout for check '%s': %w", check.Name, err)
+	}
+	var tlsConf *tls.Config
+	if consulBool(def["tlsskipverify"]) || consulString(def["tlsservername"]) != "" {
+		tlsConf = &tls.Config{
+			InsecureSkipVerify: consulBool(def["tlsskipverify"]),
+			ServerName:         consulString(def["tlsservername"]),
+		}
+	}
+
+	switch {
+	case consulString(def["http"]) != "":
+		return check, parseConsulHttpCheck(check, def, timeout, tlsConf)
+	case consulString(def["tcp"]) != "":
+		check.Host = consulString(def["tcp"])
+		check.HealthChecker = NewTcpHealthCheck(&TcpOpt{
+			Timeout: timeout,
+		})
+	case consulString(def["udp"]) != "":
+		check.Host = consulString(def["udp"])
+		check.HealthChecker = NewUdpHealthCheck(&UdpOpt{
+			Timeout: timeout,
+		})
+	case consulString(def["grpc"]) != "":
+		host, serviceNameGrpc, _ := strings.Cut(consulString(def["grpc"]), "/")
+		check.Host = host
+		check.HealthChecker = NewGrpcHealthCheck(&GrpcOpt{
+			ServiceName: serviceNameGrpc,
+			Timeout:     timeout,
+			TlsEnabled:  consulBool(def["grpcusetls"]),
+			TlsConfig:   tlsConf,
+		})
+	case len(consulStrings(def["args"])) > 0:
+		args := consulStrings(def["args"])
+		check.Host = serviceHost
+		check.HealthChecker = NewProgramHealthCheck(&ProgramOpt{
+			Path:    args[0],
+			Args:    args[1:],
+			Timeout: timeout,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported type for check '%s', only http, tcp, udp, grpc and args are supported", check.Name)
+	}
+	return check, nil
+}
+
+func parseConsulHttpCheck(check *ConsulCheck, def map[string]any, timeout time.Duration, tlsConf *tls.Config) error {
+	u, err := url.Parse(consulString(def["http"]))
+	if err != nil {
+		return fmt.Errorf("invalid http url for check '%s': %w", check.Name, err)
+	}
+	check.Host = u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		check.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	headers := make(http.Header)
+	if headerDef, ok := def["header"].(map[string]any); ok {
+		for key, values := range headerDef {
+			for _, value := range consulStrings(values) {
+				headers.Add(key, value)
+			}
+		}
+	}
+	var host string
+	if headers.Get("Host") != "" {
+		host = headers.Get("Host")
+		headers.Del("Host")
+	}
+	var send *Payload
+	if body := consulString(def["body"]); body != "" {
+		send = &Payload{Text: body}
+	}
+	check.HealthChecker = NewHttpHealthCheck(&HttpOpt{
+		Host:    host,
+		Path:    u.RequestURI(),
+		Send:    send,
+		Headers: headers,
+		// consul consider any 2xx status as passing
+		ExpectedStatuses: &IntRange{
+			Start: 200,
+			End:   300,
+		},
+		Method:     consulString(def["method"]),
+		Timeout:    timeout,
+		TlsEnabled: u.Scheme == "https",
+		TlsConfig:  tlsConf,
+	})
+	return nil
+}
+
+// normalizeConsulKeys lower cases keys and removes underscores to accept both snake case and camel case keys,
+// header values are kept as is.
+func normalizeConsulKeys(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		normalized := make(map[string]any, len(val))
+		for key, sub := range val {
+			normKey := strings.ReplaceAll(strings.ToLower(key), "_", "")
+			if normKey == "header" {
+				normalized[normKey] = sub
+				continue
+			}
+			normalized[normKey] = normalizeConsulKeys(sub)
+		}
+		return normalized
+	case []any:
+		for i, sub := range val {
+			val[i] = normalizeConsulKeys(sub)
+		}
+		return val
+	}
+	return v
+}
+
+// consulObjects accepts an object or a list of objects (as produced by HCL to json conversion)
+func consulObjects(v any) []map[string]any {
+	switch val := v.(type) {
+	case map[string]any:
+		return []map[string]any{val}
+	case []any:
+		var objects []map[string]any
+		for _, sub := range val {
+			objects = append(objects, consulObjects(sub)...)
+		}
+		return objects
+	}
+	return nil
+}
+
+func consulString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func consulStrings(v any) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		var values []string
+		for _, sub := range val {
+			values = append(values, fmt.Sprint(sub))
+		}
+		return values
+	}
+	return nil
+}
+
+func consulBool(v any) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+func consulInt(v any) int64 {
+	switch val := v.(type) {
+	case float64:
+		return int64(val)
+	case string:
+		i, _ := strconv.ParseInt(val, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func consulDuration(v any) (time.Duration, error) {
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return 0, nil
+		}
+		return time.ParseDuration(val)
+	case float64:
+		// consul api takes durations in nanoseconds when given as number
+		return time.Duration(val), nil
+	}
+	return 0, nil
+}
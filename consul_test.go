@@ -0,0 +1,88 @@
+package gohc_test
+
+import (
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Consul", func() {
+	Context("ParseConsulDefinition", func() {
+		It("should convert service checks", func() {
+			checks, err := ParseConsulDefinition(strings.NewReader(`{
+  "service": {
+    "name": "web",
+    "port": 8080,
+    "checks": [
+      {"id": "web-http", "http": "https://localhost:5000/health?full=1", "method": "POST", "interval": "10s", "timeout": "1s", "tls_skip_verify": true},
+      {"name": "web-tcp", "tcp": "localhost:22", "interval": "5s"},
+      {"name": "web-grpc", "grpc": "127.0.0.1:12345/my_service", "grpc_use_tls": true},
+      {"name": "web-script", "args": ["/bin/check", "-v"]}
+    ]
+  }
+}`))
+			Expect(err).To(BeNil())
+			Expect(checks).To(HaveLen(4))
+
+			Expect(checks[0].ServiceName).To(Equal("web"))
+			Expect(checks[0].ID).To(Equal("web-http"))
+			Expect(checks[0].Interval).To(Equal(10 * time.Second))
+			Expect(checks[0].Host).To(Equal("localhost:5000"))
+			Expect(checks[0].HealthChecker).To(BeAssignableToTypeOf(&HttpHealthCheck{}))
+
+			Expect(checks[1].Host).To(Equal("localhost:22"))
+			Expect(checks[1].HealthChecker).To(BeAssignableToTypeOf(&TcpHealthCheck{}))
+
+			Expect(checks[2].Host).To(Equal("127.0.0.1:12345"))
+			Expect(checks[2].HealthChecker.(*GrpcHealthCheck).String()).To(ContainSubstring("my_service"))
+
+			Expect(checks[3].Host).To(Equal("127.0.0.1:8080"))
+			Expect(checks[3].HealthChecker).To(BeAssignableToTypeOf(&ProgramHealthCheck{}))
+		})
+		It("should accept camel case keys and list of services", func() {
+			checks, err := ParseConsulDefinition(strings.NewReader(`{
+  "Services": [
+    {"Name": "a", "Check": {"TCP": "localhost:1", "Interval": "1s"}},
+    {"Name": "b", "Check": [{"TCP": "localhost:2"}]}
+  ]
+}`))
+			Expect(err).To(BeNil())
+			Expect(checks).To(HaveLen(2))
+			Expect(checks[0].ServiceName).To(Equal("a"))
+			Expect(checks[0].Interval).To(Equal(time.Second))
+			Expect(checks[1].Host).To(Equal("localhost:2"))
+		})
+		It("should return an error on unsupported check type", func() {
+			_, err := ParseConsulDefinition(strings.NewReader(`{"check": {"name": "ttl", "ttl": "30s"}}`))
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("unsupported"))
+		})
+		It("should convert http check usable against server", func() {
+			server := ghttp.NewServer()
+			defer server.Close()
+			server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.Method).To(Equal("PUT"))
+				Expect(req.URL.Path).To(Equal("/health"))
+				Expect(req.Host).To(Equal("myhost"))
+				Expect(req.Header.Get("X-Test")).To(Equal("test"))
+				w.WriteHeader(204)
+			})
+
+			checks, err := ParseConsulDefinition(strings.NewReader(`{"check": {
+  "http": "` + server.URL() + `/health",
+  "method": "PUT",
+  "header": {"X-Test": ["test"], "Host": ["myhost"]}
+}}`))
+			Expect(err).To(BeNil())
+			Expect(checks).To(HaveLen(1))
+
+			err = checks[0].HealthChecker.Check(checks[0].Host)
+			Expect(err).To(BeNil())
+			Expect(server.ReceivedRequests()).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,325 @@
+package gohc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Target is a host to check found by a Discoverer.
+type Target struct {
+	// Host in the form host:port
+	Host string
+	// Labels attached to the target
+	Labels map[string]string
+}
+
+// Discoverer gives the list of targets to check.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]*Target, error)
+}
+
+// TargetsHosts gives the hosts of targets, useful to be passed to CheckAll.
+func TargetsHosts(targets []*Target) []string {
+	hosts := make([]string, len(targets))
+	for i, target := range targets {
+		hosts[i] = target.Host
+	}
+	return hosts
+}
+
+// StaticDiscoverer always gives the same list of hosts.
+type StaticDiscoverer struct {
+	hosts []string
+}
+
+func NewStaticDiscoverer(hosts ...string) *StaticDiscoverer {
+	return &StaticDiscoverer{
+		hosts: hosts,
+	}
+}
+
+func (d *StaticDiscoverer) Discover(ctx context.Context) ([]*Target, error) {
+	targets := make([]*Target, len(d.hosts))
+	for i, host := range d.hosts {
+		targets[i] = &Target{Host: host}
+	}
+	return targets, nil
+}
+
+func (d *StaticDiscoverer) String() string {
+	return "StaticDiscoverer"
+}
+
+// SrvDiscoverer gives targets from DNS SRV records.
+// Port in host is the one from the SRV record, an AltPort set on checker still override it during check.
+// Labels "srv_priority" and "srv_weight" are set on targets.
+type SrvDiscoverer struct {
+	// Service name of the SRV record, if service and proto are empty Name is looked up directly.
+	Service string
+	// Proto of the SRV record (e.g.: tcp, udp)
+	Proto string
+	// Name domain name to look up
+	Name string
+	// Resolver if set, its servers and timeout are used to look up SRV records instead of system resolver.
+	Resolver *ResolverOpt
+}
+
+func (d *SrvDiscoverer) Discover(ctx context.Context) ([]*Target, error) {
+	srvs, err := newResolver(d.Resolver).lookupSrv(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to lookup srv records for %s: %w", d.Name, err)
+	}
+	targets := make([]*Target, len(srvs))
+	for i, srv := range srvs {
+		targets[i] = &Target{
+			Host: net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+			Labels: map[string]string{
+				"srv_priority": strconv.Itoa(int(srv.Priority)),
+				"srv_weight":   strconv.Itoa(int(srv.Weight)),
+			},
+		}
+	}
+	return targets, nil
+}
+
+func (d *SrvDiscoverer) String() string {
+	return fmt.Sprintf("SrvDiscoverer, name '%s'", d.Name)
+}
+
+// DnsDiscoverer gives a target for each A/AAAA record of a name.
+type DnsDiscoverer struct {
+	// Name domain name to look up
+	Name string
+	// Port to set on each target
+	Port uint32
+	// Family of addresses to keep, default to IpFamilyAll
+	Family IpFamily
+}
+
+func (d *DnsDiscoverer) Discover(ctx context.Context) ([]*Target, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to resolve %s: %w", d.Name, err)
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	ips = filterIps(ips, d.Family)
+	targets := make([]*Target, len(ips))
+	for i, ip := range ips {
+		targets[i] = &Target{
+			Host: net.JoinHostPort(ip.String(), strconv.Itoa(int(d.Port))),
+			Labels: map[string]string{
+				"dns_name": d.Name,
+			},
+		}
+	}
+	return targets, nil
+}
+
+func (d *DnsDiscoverer) String() string {
+	return fmt.Sprintf("DnsDiscoverer, name '%s'", d.Name)
+}
+
+// fileTargetGroup is a group of targets sharing labels in a file, same format as prometheus file_sd.
+type fileTargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// FileDiscoverer gives targets from a file, file is read again only when modified.
+// Format is chosen from file extension:
+//   - .json: a list of groups as `[{"targets": ["host:port"], "labels": {"key": "value"}}]`
+//   - .yml or .yaml: same as json in yaml format
+//   - any other: a host per line, empty lines and lines starting with # are ignored
+type FileDiscoverer struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	targets []*Target
+}
+
+func NewFileDiscoverer(path string) *FileDiscoverer {
+	return &FileDiscoverer{
+		path: path,
+	}
+}
+
+func (d *FileDiscoverer) Discover(ctx context.Context) ([]*Target, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return nil, err
+	}
+	if d.targets != nil && info.ModTime().Equal(d.modTime) {
+		return d.targets, nil
+	}
+	b, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := parseTargetsFile(filepath.Ext(d.path), b)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse targets file %s: %w", d.path, err)
+	}
+	d.modTime = info.ModTime()
+	d.targets = targets
+	return targets, nil
+}
+
+func (d *FileDiscoverer) String() string {
+	return fmt.Sprintf("FileDiscoverer, path '%s'", d.path)
+}
+
+func parseTargetsFile(ext string, b []byte) ([]*Target, error) {
+	var groups []*fileTargetGroup
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(b, &groups); err != nil {
+			return nil, err
+		}
+	case ".yml", ".yaml":
+		if err := yaml.Unmarshal(b, &groups); err != nil {
+			return nil, err
+		}
+	default:
+		group := &fileTargetGroup{}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			group.Targets = append(group.Targets, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	targets := make([]*Target, 0)
+	for _, group := range groups {
+		for _, host := range group.Targets {
+			targets = append(targets, &Target{
+				Host:   host,
+				Labels: group.Labels,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// DiscoveryWatcherOpt Describes how a DiscoveryWatcher refresh targets.
+type DiscoveryWatcherOpt struct {
+	// Interval between two discoveries. If left empty (default to 30s)
+	Interval time.Duration
+	// OnChange if set, is called after a discovery when targets have been added or removed.
+	OnChange func(added []*Target, removed []*Target)
+	// OnError if set, is called when discovery failed, previous targets are kept.
+	OnError func(err error)
+}
+
+// DiscoveryWatcher periodically runs a Discoverer and keeps the current list of targets,
+// targets are identified by their host.
+type DiscoveryWatcher struct {
+	discoverer Discoverer
+	opt        *DiscoveryWatcherOpt
+	mu         sync.RWMutex
+	targets    map[string]*Target
+}
+
+func NewDiscoveryWatcher(discoverer Discoverer, opt *DiscoveryWatcherOpt) *DiscoveryWatcher {
+	return &DiscoveryWatcher{
+		discoverer: discoverer,
+		opt:        opt,
+		targets:    make(map[string]*Target),
+	}
+}
+
+// Run refresh targets until ctx is done, first refresh is done immediately.
+func (w *DiscoveryWatcher) Run(ctx context.Context) {
+	interval := w.opt.Interval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := w.Refresh(ctx)
+		if err != nil && w.opt.OnError != nil {
+			w.opt.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh runs discovery once and updates targets.
+func (w *DiscoveryWatcher) Refresh(ctx context.Context) error {
+	discovered, err := w.discoverer.Discover(ctx)
+	if err != nil {
+		return err
+	}
+	newTargets := make(map[string]*Target)
+	for _, target := range discovered {
+		newTargets[target.Host] = target
+	}
+
+	w.mu.Lock()
+	var added, removed []*Target
+	for host, target := range newTargets {
+		if _, ok := w.targets[host]; !ok {
+			added = append(added, target)
+		}
+	}
+	for host, target := range w.targets {
+		if _, ok := newTargets[host]; !ok {
+			removed = append(removed, target)
+		}
+	}
+	w.targets = newTargets
+	w.mu.Unlock()
+
+	if (len(added) > 0 || len(removed) > 0) && w.opt.OnChange != nil {
+		sortTargets(added)
+		sortTargets(removed)
+		w.opt.OnChange(added, removed)
+	}
+	return nil
+}
+
+// Targets gives current targets sorted by host.
+func (w *DiscoveryWatcher) Targets() []*Target {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	targets := make([]*Target, 0, len(w.targets))
+	for _, target := range w.targets {
+		targets = append(targets, target)
+	}
+	sortTargets(targets)
+	return targets
+}
+
+func sortTargets(targets []*Target) {
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Host < targets[j].Host
+	})
+}
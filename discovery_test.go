@@ -0,0 +1,137 @@
+package gohc_test
+
+import (
+	"context"
+	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Discovery", func() {
+	var tmpDir string
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+	})
+	Context("FileDiscoverer", func() {
+		It("should read targets with labels from json file", func() {
+			path := filepath.Join(tmpDir, "targets.json")
+			err := os.WriteFile(path, []byte(`[{"targets": ["127.0.0.1:80", "127.0.0.2:80"], "labels": {"env": "prod"}}]`), 0644)
+			Expect(err).To(BeNil())
+
+			targets, err := NewFileDiscoverer(path).Discover(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(targets)).To(Equal([]string{"127.0.0.1:80", "127.0.0.2:80"}))
+			Expect(targets[0].Labels).To(HaveKeyWithValue("env", "prod"))
+		})
+		It("should read targets with labels from yaml file", func() {
+			path := filepath.Join(tmpDir, "targets.yml")
+			err := os.WriteFile(path, []byte("- targets: [\"127.0.0.1:80\"]\n  labels:\n    env: dev\n"), 0644)
+			Expect(err).To(BeNil())
+
+			targets, err := NewFileDiscoverer(path).Discover(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(targets)).To(Equal([]string{"127.0.0.1:80"}))
+			Expect(targets[0].Labels).To(HaveKeyWithValue("env", "dev"))
+		})
+		It("should read hosts list file", func() {
+			path := filepath.Join(tmpDir, "hosts")
+			err := os.WriteFile(path, []byte("# comment\n127.0.0.1:80\n\n127.0.0.2:80\n"), 0644)
+			Expect(err).To(BeNil())
+
+			targets, err := NewFileDiscoverer(path).Discover(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(targets)).To(Equal([]string{"127.0.0.1:80", "127.0.0.2:80"}))
+		})
+	})
+	Context("SrvDiscoverer", func() {
+		It("should give a target with priority and weight for each record", func() {
+			dnsServer, err := testhelpers.NewDnsServer()
+			Expect(err).To(BeNil())
+			defer dnsServer.Close()
+			dnsServer.AddSrvRecord("_http._tcp.svc.gohc.test", &net.SRV{
+				Target:   "backend.gohc.test",
+				Port:     8080,
+				Priority: 10,
+				Weight:   5,
+			})
+
+			targets, err := (&SrvDiscoverer{
+				Service: "http",
+				Proto:   "tcp",
+				Name:    "svc.gohc.test",
+				Resolver: &ResolverOpt{
+					Servers: []string{dnsServer.Addr()},
+				},
+			}).Discover(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(targets)).To(Equal([]string{"backend.gohc.test:8080"}))
+			Expect(targets[0].Labels).To(HaveKeyWithValue("srv_priority", "10"))
+			Expect(targets[0].Labels).To(HaveKeyWithValue("srv_weight", "5"))
+		})
+	})
+	Context("DnsDiscoverer", func() {
+		It("should give a target for each address", func() {
+			targets, err := (&DnsDiscoverer{
+				Name:   "localhost",
+				Port:   8080,
+				Family: IpFamilyV4,
+			}).Discover(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(targets)).To(ContainElement("127.0.0.1:8080"))
+		})
+	})
+	Context("DiscoveryWatcher", func() {
+		It("should notify added and removed targets", func() {
+			path := filepath.Join(tmpDir, "hosts")
+			err := os.WriteFile(path, []byte("127.0.0.1:80\n127.0.0.2:80\n"), 0644)
+			Expect(err).To(BeNil())
+			var added, removed []*Target
+			watcher := NewDiscoveryWatcher(NewFileDiscoverer(path), &DiscoveryWatcherOpt{
+				OnChange: func(a []*Target, r []*Target) {
+					added = a
+					removed = r
+				},
+			})
+
+			err = watcher.Refresh(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(added)).To(Equal([]string{"127.0.0.1:80", "127.0.0.2:80"}))
+			Expect(removed).To(BeEmpty())
+
+			err = os.WriteFile(path, []byte("127.0.0.2:80\n127.0.0.3:80\n"), 0644)
+			Expect(err).To(BeNil())
+			future := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(path, future, future)).To(Succeed())
+
+			err = watcher.Refresh(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(added)).To(Equal([]string{"127.0.0.3:80"}))
+			Expect(TargetsHosts(removed)).To(Equal([]string{"127.0.0.1:80"}))
+			Expect(TargetsHosts(watcher.Targets())).To(Equal([]string{"127.0.0.2:80", "127.0.0.3:80"}))
+		})
+		It("should keep previous targets when discovery fail", func() {
+			path := filepath.Join(tmpDir, "hosts")
+			err := os.WriteFile(path, []byte("127.0.0.1:80\n"), 0644)
+			Expect(err).To(BeNil())
+			watcher := NewDiscoveryWatcher(NewFileDiscoverer(path), &DiscoveryWatcherOpt{})
+			err = watcher.Refresh(context.Background())
+			Expect(err).To(BeNil())
+			Expect(TargetsHosts(watcher.Targets())).To(Equal([]string{"127.0.0.1:80"}))
+
+			Expect(os.Remove(path)).To(Succeed())
+			err = watcher.Refresh(context.Background())
+			Expect(err).ToNot(BeNil())
+			Expect(TargetsHosts(watcher.Targets())).To(Equal([]string{"127.0.0.1:80"}))
+		})
+	})
+	It("StaticDiscoverer should give given hosts", func() {
+		targets, err := NewStaticDiscoverer("127.0.0.1:80").Discover(context.Background())
+		Expect(err).To(BeNil())
+		Expect(TargetsHosts(targets)).To(Equal([]string{"127.0.0.1:80"}))
+	})
+})
@@ -27,11 +27,22 @@ func main() {
 			Start: 200,
 			End:   300, // end is exclusive
 		},
-		CodecClientType: gohc.CodecClientType_HTTP1,
-		Method:          http.MethodGet,
-		Timeout:         5 * time.Second,
-		TlsEnabled:      false,
-		TlsConfig:       nil,
+		// other ranges of statuses considered healthy
+		ExpectedStatusRanges: []*gohc.IntRange{
+			{Start: 401, End: 402},
+		},
+		// statuses considered as failure only after UnhealthyThreshold consecutive checks, before it returns a warning
+		RetriableStatuses: []*gohc.IntRange{
+			{Start: 503, End: 504},
+		},
+		UnhealthyThreshold: 3,
+		CodecClientType:    gohc.CodecClientType_HTTP1,
+		// fail if server answer with another protocol than the one requested
+		StrictProtocol: false,
+		Method:         http.MethodGet,
+		Timeout:        5 * time.Second,
+		TlsEnabled:     false,
+		TlsConfig:      nil,
 		// you can set an alternative port for host which will override any port set in the host during check
 		AltPort: 0,
 	}
@@ -7,13 +7,62 @@ import (
 	"fmt"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"net"
+	"strings"
+	"sync"
 	"time"
 )
 
+type GrpcServicePolicy int
+
+const (
+	// GrpcServicePolicyAll all services must be SERVING
+	GrpcServicePolicyAll GrpcServicePolicy = iota
+	// GrpcServicePolicyAny one service must be SERVING
+	GrpcServicePolicyAny
+	// GrpcServicePolicyQuorum more than half of services must be SERVING
+	GrpcServicePolicyQuorum
+)
+
+var grpcServicePolicyName = map[GrpcServicePolicy]string{
+	GrpcServicePolicyAll:    "all",
+	GrpcServicePolicyAny:    "any",
+	GrpcServicePolicyQuorum: "quorum",
+}
+
+// GrpcServiceResult gives status of a service checked.
+type GrpcServiceResult struct {
+	ServiceName string
+	// Status sent by server, UNKNOWN if Err is set by a failed request
+	Status healthpb.HealthCheckResponse_ServingStatus
+	// Err is the error of the service, nil if it is SERVING
+	Err error
+}
+
+// GrpcResult gives details on a gRPC check.
+type GrpcResult struct {
+	// Services results in order of services checked
+	Services []*GrpcServiceResult
+	// ConnReused true if the connection used was cached by a previous check, a cached connection in
+	// TRANSIENT_FAILURE is not reused and is replaced by a new one
+	ConnReused bool
+	// ConnState state of the connection used once check is done (e.g.: READY, TRANSIENT_FAILURE)
+	ConnState connectivity.State
+	// Response json encoded response of Method, if set
+	Response []byte
+	// Duration of the check
+	Duration time.Duration
+}
+
 // GrpcOpt Describes the gRPC health check specific options.
 type GrpcOpt struct {
 	// An optional service name parameter which will be sent to gRPC service in
@@ -22,6 +71,14 @@ type GrpcOpt struct {
 	// message. See `gRPC health-checking overview
 	// <https://github.com/grpc/grpc/blob/master/doc/health-checking.md>`_ for more information.
 	ServiceName string
+	// ServiceNames if set, replaces ServiceName and each service is checked over the same connection,
+	// ServicePolicy gives how many of them must be SERVING.
+	ServiceNames []string
+	// ServicePolicy to consider host healthy from ServiceNames results, default to GrpcServicePolicyAll
+	ServicePolicy GrpcServicePolicy
+	// Method if set, this unary method is called instead of health check and its response is asserted,
+	// ServiceName and ServiceNames are ignored.
+	Method *GrpcMethodOpt
 	// The value of the :authority header in the gRPC health check request. If
 	// left empty (default value) this will be host in check.
 	// The authority header can be customized for a specific endpoint by setting
@@ -36,56 +93,233 @@ type GrpcOpt struct {
 	// AltPort specifies the port to use for gRPC health check requests.
 	// If left empty it taks the port from host during check.
 	AltPort uint32
+	// Auth if set, gives credentials sent as metadata with health check request (e.g.: BasicAuth, OAuth2ClientCredentials).
+	Auth AuthProvider
+	// PerRPCCredentials if set, gives other credentials attached to each request (e.g.: from google.golang.org/grpc/credentials/oauth).
+	PerRPCCredentials credentials.PerRPCCredentials
+	// Metadata sent with each request (e.g.: metadata.Pairs("x-tenant", "acme")).
+	Metadata metadata.MD
+	// Compression name of compressor used for requests (e.g.: gzip), other compressors than gzip must be
+	// registered with encoding.RegisterCompressor.
+	Compression string
+	// Proxy if set, connections are made through this proxy.
+	Proxy *ProxyOpt
+	// ProxyProtocol if set, a PROXY protocol header is sent at the beginning of each connection, before tls.
+	// Ignored for unix socket hosts.
+	ProxyProtocol *ProxyProtocolOpt
+	// Network if set, describes source address, interface and socket options used by connections.
+	// Ignored for unix socket hosts.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
+	// ReuseConnection set to true to keep connection to a host in cache between checks instead of
+	// connecting on each check, cached connections are closed with Close.
+	ReuseConnection bool
+	// KeepaliveTime if set, keepalive pings are sent after this duration without activity on connection,
+	// even without running request (server keepalive enforcement policy must permit it).
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout time waited for keepalive ping ack before closing connection. If left empty (default to 20s)
+	KeepaliveTimeout time.Duration
+	// WarnLatency if set, a successful check taking more than this duration returns a WarnError.
+	WarnLatency time.Duration
 }
 
 type GrpcHealthCheck struct {
-	opt *GrpcOpt
+	opt     *GrpcOpt
+	method  *grpcMethod
+	optErr  error
+	conns   map[string]*grpc.ClientConn
+	connsMu sync.Mutex
 }
 
 func NewGrpcHealthCheck(opt *GrpcOpt) *GrpcHealthCheck {
+	var method *grpcMethod
+	var err error
+	if opt.Method != nil {
+		method, err = newGrpcMethod(opt.Method)
+	}
+	if err == nil && opt.Compression != "" && encoding.GetCompressor(opt.Compression) == nil {
+		err = fmt.Errorf("compressor %s is not registered", opt.Compression)
+	}
 	return &GrpcHealthCheck{
-		opt: opt,
+		opt:    opt,
+		method: method,
+		optErr: err,
+		conns:  make(map[string]*grpc.ClientConn),
 	}
 }
 
 func (h *GrpcHealthCheck) Check(host string) error {
-	conn, err := h.makeGrpcConn(host)
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// CheckWithResult runs the check as Check does and gives details on each service checked.
+func (h *GrpcHealthCheck) CheckWithResult(host string) (*GrpcResult, error) {
+	start := time.Now()
+	result := &GrpcResult{}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	return result, checkLatency(start, h.opt.WarnLatency)
+}
+
+// Close closes connections cached with ReuseConnection.
+func (h *GrpcHealthCheck) Close() {
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+	for host, conn := range h.conns {
+		conn.Close()
+		delete(h.conns, host)
+	}
+}
+
+func (h *GrpcHealthCheck) check(host string, result *GrpcResult) error {
+	conn, reused, err := h.conn(host)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	if !h.opt.ReuseConnection {
+		defer conn.Close()
+	}
+	result.ConnReused = reused
+	defer func() {
+		result.ConnState = conn.GetState()
+	}()
 
-	timeout := h.opt.Timeout
-	if timeout == 0 {
-		timeout = 5 * time.Second
+	if h.method != nil {
+		ctx, cancel := context.WithTimeout(h.outgoingContext(context.Background()), h.timeout())
+		defer cancel()
+		result.Response, err = h.method.call(ctx, conn)
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
 	client := healthpb.NewHealthClient(conn)
+	if len(h.opt.ServiceNames) == 0 {
+		serviceResult := h.checkService(client, h.opt.ServiceName)
+		result.Services = []*GrpcServiceResult{serviceResult}
+		return serviceResult.Err
+	}
+
+	result.Services = make([]*GrpcServiceResult, len(h.opt.ServiceNames))
+	var wg sync.WaitGroup
+	for i, serviceName := range h.opt.ServiceNames {
+		wg.Add(1)
+		go func(index int, serviceName string) {
+			defer wg.Done()
+			result.Services[index] = h.checkService(client, serviceName)
+		}(i, serviceName)
+	}
+	wg.Wait()
+	return h.evaluate(result.Services)
+}
+
+// conn gives connection to host, from cache with ReuseConnection, and true if it was cached.
+func (h *GrpcHealthCheck) conn(host string) (*grpc.ClientConn, bool, error) {
+	if !h.opt.ReuseConnection {
+		conn, err := h.makeGrpcConn(host)
+		return conn, false, err
+	}
+	h.connsMu.Lock()
+	defer h.connsMu.Unlock()
+	if conn, ok := h.conns[host]; ok {
+		state := conn.GetState()
+		if state != connectivity.Shutdown && state != connectivity.TransientFailure {
+			return conn, true, nil
+		}
+		// failing connection waits for its reconnect backoff, a new one is tried right away
+		conn.Close()
+		delete(h.conns, host)
+	}
+	conn, err := h.makeGrpcConn(host)
+	if err != nil {
+		return nil, false, err
+	}
+	h.conns[host] = conn
+	return conn, false, nil
+}
+
+func (h *GrpcHealthCheck) checkService(client healthpb.HealthClient, serviceName string) *GrpcServiceResult {
+	result := &GrpcServiceResult{
+		ServiceName: serviceName,
+	}
+	ctx, cancel := context.WithTimeout(h.outgoingContext(context.Background()), h.timeout())
+	defer cancel()
 	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{
-		Service: h.opt.ServiceName,
+		Service: serviceName,
 	})
 	if err != nil {
+		result.Err = fmt.Errorf("gRPC health check failed: %w", err)
 		if stat, ok := status.FromError(err); ok {
 			switch stat.Code() {
 			case codes.Unimplemented:
-				return fmt.Errorf("gRPC server does not implement the health protocol: %w", err)
+				result.Err = fmt.Errorf("gRPC server does not implement the health protocol: %w", err)
 			case codes.DeadlineExceeded:
-				return fmt.Errorf("gRPC health check timeout: %w", err)
+				result.Err = fmt.Errorf("gRPC health check timeout: %w", err)
 			}
 		}
-
-		return fmt.Errorf("gRPC health check failed: %w", err)
+		return result
 	}
 
+	result.Status = resp.Status
 	if resp.Status != healthpb.HealthCheckResponse_SERVING {
-		return fmt.Errorf("received gRPC status code: %v", resp.Status)
+		result.Err = fmt.Errorf("received gRPC status code: %v", resp.Status)
+	}
+	return result
+}
+
+func (h *GrpcHealthCheck) evaluate(results []*GrpcServiceResult) error {
+	var resultErr string
+	nbServing := 0
+	for _, result := range results {
+		if result.Err != nil {
+			resultErr = fmt.Sprintf("%s- '%s': %s\n", resultErr, result.ServiceName, result.Err)
+			continue
+		}
+		nbServing++
+	}
+
+	var healthy bool
+	switch h.opt.ServicePolicy {
+	case GrpcServicePolicyAny:
+		healthy = nbServing > 0
+	case GrpcServicePolicyQuorum:
+		healthy = nbServing > len(results)/2
+	default:
+		healthy = nbServing == len(results)
+	}
+	if !healthy {
+		return fmt.Errorf("policy %s not satisfied, %d/%d services serving:\n%s",
+			grpcServicePolicyName[h.opt.ServicePolicy], nbServing, len(results), resultErr)
 	}
 	return nil
 }
 
+func (h *GrpcHealthCheck) timeout() time.Duration {
+	if h.opt.Timeout == 0 {
+		return 5 * time.Second
+	}
+	return h.opt.Timeout
+}
+
+// outgoingContext gives ctx with Metadata to send
+func (h *GrpcHealthCheck) outgoingContext(ctx context.Context) context.Context {
+	if len(h.opt.Metadata) == 0 {
+		return ctx
+	}
+	md := metadata.MD{}
+	for key, values := range h.opt.Metadata {
+		md.Append(key, values...)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
 func (h *GrpcHealthCheck) makeGrpcConn(host string) (*grpc.ClientConn, error) {
+	if h.optErr != nil {
+		return nil, h.optErr
+	}
 	var err error
 	host, err = FormatHost(host, h.opt.AltPort)
 	if err != nil {
@@ -98,14 +332,64 @@ func (h *GrpcHealthCheck) makeGrpcConn(host string) (*grpc.ClientConn, error) {
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(h.opt.TlsConfig)))
 	}
 
-	timeout := h.opt.Timeout
-	if timeout == 0 {
-		timeout = 5 * time.Second
+	timeout := h.timeout()
+
+	if h.opt.KeepaliveTime > 0 {
+		keepaliveTimeout := h.opt.KeepaliveTimeout
+		if keepaliveTimeout == 0 {
+			keepaliveTimeout = 20 * time.Second
+		}
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                h.opt.KeepaliveTime,
+			Timeout:             keepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+
+	if h.opt.Auth != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(&grpcAuthCredentials{provider: h.opt.Auth}))
+	}
+	if h.opt.PerRPCCredentials != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(h.opt.PerRPCCredentials))
+	}
+	if h.opt.Authority != "" {
+		opts = append(opts, grpc.WithAuthority(h.opt.Authority))
+	}
+	if h.opt.Compression != "" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(h.opt.Compression)))
+	}
+
+	if (h.opt.Proxy != nil || h.opt.ProxyProtocol != nil || h.opt.Network != nil || h.opt.Resolver != nil) && !IsUnixHost(host) {
+		dial := makeNetworkDial(h.opt.Network, &net.Dialer{})
+		if h.opt.Proxy != nil {
+			dial, err = makeProxyDial(h.opt.Proxy, dial)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if h.opt.Resolver != nil {
+			dial = wrapDialResolver(newResolver(h.opt.Resolver), dial)
+		}
+		if h.opt.ProxyProtocol != nil {
+			dial = wrapDialProxyProtocol(h.opt.ProxyProtocol, dial)
+		}
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dial(ctx, "tcp", addr)
+		}))
+	}
+
+	target := host
+	if IsUnixHost(host) {
+		_, socketPath := dialTarget(host)
+		target = "unix://" + socketPath
+		if strings.HasPrefix(socketPath, "@") {
+			target = "unix-abstract:" + strings.TrimPrefix(socketPath, "@")
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	conn, err := grpc.DialContext(ctx, host, opts...)
+	conn, err := grpc.DialContext(ctx, target, opts...)
 	if err != nil {
 		if errors.Is(err, context.DeadlineExceeded) {
 			return nil, fmt.Errorf("fail to connect to %s within %s: %w", host, timeout, err)
@@ -115,6 +399,18 @@ func (h *GrpcHealthCheck) makeGrpcConn(host string) (*grpc.ClientConn, error) {
 	return conn, nil
 }
 
+func (h *GrpcHealthCheck) pinIp(hostname string, ip net.IP) HealthChecker {
+	opt := *h.opt
+	opt.Resolver = pinResolver(opt.Resolver, hostname, ip)
+	return NewGrpcHealthCheck(&opt)
+}
+
 func (h *GrpcHealthCheck) String() string {
+	if h.opt.Method != nil {
+		return fmt.Sprintf("GrpcHealthCheck, method '%s'", h.opt.Method.Name)
+	}
+	if len(h.opt.ServiceNames) > 0 {
+		return fmt.Sprintf("GrpcHealthCheck, service names '%s'", strings.Join(h.opt.ServiceNames, "', '"))
+	}
 	return fmt.Sprintf("GrpcHealthCheck, service name '%s'", h.opt.ServiceName)
 }
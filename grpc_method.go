@@ -0,0 +1,271 @@
+package gohc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// GrpcMethodOpt Describes a unary method called instead of gRPC health protocol, for services which do not implement it.
+type GrpcMethodOpt struct {
+	// Name full name of method (e.g.: my.package.MyService/GetStatus or my.package.MyService.GetStatus)
+	Name string
+	// Request json encoded request message. If left empty (default to {})
+	Request string
+	// DescriptorSet if set, serialized FileDescriptorSet describing method and its messages
+	// (e.g.: from protoc --include_imports --descriptor_set_out), otherwise server reflection is used.
+	DescriptorSet []byte
+	// Assertions to make on response, all must pass and all failing assertions are reported in error.
+	// Json path and body assertions apply to json encoded response message, header assertions to response metadata.
+	Assertions []*HttpAssertion
+}
+
+type grpcMethod struct {
+	opt        *GrpcMethodOpt
+	service    string
+	method     string
+	assertions []*httpAssertionMatcher
+	// descriptor from DescriptorSet or from first successful server reflection
+	desc   protoreflect.MethodDescriptor
+	descMu sync.Mutex
+}
+
+func newGrpcMethod(opt *GrpcMethodOpt) (*grpcMethod, error) {
+	name := strings.TrimPrefix(opt.Name, "/")
+	sep := strings.LastIndex(name, "/")
+	if sep == -1 {
+		sep = strings.LastIndex(name, ".")
+	}
+	if sep <= 0 || sep == len(name)-1 {
+		return nil, fmt.Errorf("invalid method name '%s', expected package.Service/Method", opt.Name)
+	}
+	assertions, err := makeHttpAssertionMatchers(opt.Assertions)
+	if err != nil {
+		return nil, err
+	}
+	m := &grpcMethod{
+		opt:        opt,
+		service:    name[:sep],
+		method:     name[sep+1:],
+		assertions: assertions,
+	}
+	if len(opt.DescriptorSet) == 0 {
+		return m, nil
+	}
+	fdSet := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(opt.DescriptorSet, fdSet); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	m.desc, err = m.findDescriptor(fdSet.File)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// findDescriptor builds files and gives descriptor of method, dependencies missing from files are taken
+// from well known types registered globally.
+func (m *grpcMethod) findDescriptor(fdProtos []*descriptorpb.FileDescriptorProto) (protoreflect.MethodDescriptor, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(fdProtos))
+	for _, fdProto := range fdProtos {
+		byName[fdProto.GetName()] = fdProto
+	}
+	files := &protoregistry.Files{}
+	var register func(name string) error
+	register = func(name string) error {
+		if _, err := files.FindFileByPath(name); err == nil {
+			return nil
+		}
+		fdProto, ok := byName[name]
+		if !ok {
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("missing file descriptor %s", name)
+			}
+			return files.RegisterFile(fd)
+		}
+		for _, dep := range fdProto.GetDependency() {
+			if err := register(dep); err != nil {
+				return err
+			}
+		}
+		fd, err := protodesc.NewFile(fdProto, files)
+		if err != nil {
+			return fmt.Errorf("invalid file descriptor %s: %w", name, err)
+		}
+		return files.RegisterFile(fd)
+	}
+	for name := range byName {
+		if err := register(name); err != nil {
+			return nil, err
+		}
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(m.service))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found in descriptors", m.service)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", m.service)
+	}
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(m.method))
+	if methodDesc == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", m.method, m.service)
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s/%s is not unary", m.service, m.method)
+	}
+	return methodDesc, nil
+}
+
+// reflectDescriptor asks file descriptors of service and their dependencies to server reflection
+func (m *grpcMethod) reflectDescriptor(ctx context.Context, conn *grpc.ClientConn) (protoreflect.MethodDescriptor, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gRPC server reflection failed: %w", err)
+	}
+	var fdProtos []*descriptorpb.FileDescriptorProto
+	known := make(map[string]bool)
+	request := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: m.service,
+		},
+	}
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, fmt.Errorf("gRPC server reflection failed: %w", err)
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				return nil, fmt.Errorf("gRPC server does not implement server reflection: %w", err)
+			}
+			return nil, fmt.Errorf("gRPC server reflection failed: %w", err)
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			return nil, fmt.Errorf("gRPC server reflection failed for %s: %s", m.service, errResp.GetErrorMessage())
+		}
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fdProto := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, fdProto); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor from server reflection: %w", err)
+			}
+			if known[fdProto.GetName()] {
+				continue
+			}
+			known[fdProto.GetName()] = true
+			fdProtos = append(fdProtos, fdProto)
+		}
+
+		// ask next dependency not sent by server
+		request = nil
+		for _, fdProto := range fdProtos {
+			for _, dep := range fdProto.GetDependency() {
+				if known[dep] {
+					continue
+				}
+				if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					continue
+				}
+				known[dep] = true
+				request = &reflectionpb.ServerReflectionRequest{
+					MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{
+						FileByFilename: dep,
+					},
+				}
+				break
+			}
+			if request != nil {
+				break
+			}
+		}
+	}
+	stream.CloseSend()
+	return m.findDescriptor(fdProtos)
+}
+
+// descriptor gives method descriptor, server reflection is only asked until a descriptor is found
+func (m *grpcMethod) descriptor(ctx context.Context, conn *grpc.ClientConn) (protoreflect.MethodDescriptor, error) {
+	m.descMu.Lock()
+	defer m.descMu.Unlock()
+	if m.desc != nil {
+		return m.desc, nil
+	}
+	desc, err := m.reflectDescriptor(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	m.desc = desc
+	return desc, nil
+}
+
+// call invokes method and gives json encoded response
+func (m *grpcMethod) call(ctx context.Context, conn *grpc.ClientConn) ([]byte, error) {
+	desc, err := m.descriptor(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	request := m.opt.Request
+	if request == "" {
+		request = "{}"
+	}
+	req := dynamicpb.NewMessage(desc.Input())
+	if err := protojson.Unmarshal([]byte(request), req); err != nil {
+		return nil, fmt.Errorf("invalid request for %s: %w", desc.Input().FullName(), err)
+	}
+	resp := dynamicpb.NewMessage(desc.Output())
+	var header metadata.MD
+	err = conn.Invoke(ctx, fmt.Sprintf("/%s/%s", m.service, m.method), req, resp, grpc.Header(&header))
+	if err != nil {
+		if status.Code(err) == codes.DeadlineExceeded {
+			return nil, fmt.Errorf("gRPC method call timeout: %w", err)
+		}
+		return nil, fmt.Errorf("gRPC method call failed: %w", err)
+	}
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("fail to encode response to json: %w", err)
+	}
+	// protojson output is not stable on purpose, body assertions need a stable one
+	var body bytes.Buffer
+	if err := json.Compact(&body, b); err != nil {
+		return nil, fmt.Errorf("fail to encode response to json: %w", err)
+	}
+
+	respHeader := make(http.Header, len(header))
+	for key, values := range header {
+		for _, value := range values {
+			respHeader.Add(key, value)
+		}
+	}
+	var resultErr string
+	for _, assertion := range m.assertions {
+		ok, got := assertion.match(respHeader, body.Bytes())
+		if !ok {
+			resultErr = fmt.Sprintf("%s- %s: %s\n", resultErr, assertion.assertion, got)
+		}
+	}
+	if resultErr != "" {
+		return body.Bytes(), fmt.Errorf("response assertions failed:\n%s", resultErr)
+	}
+	return body.Bytes(), nil
+}
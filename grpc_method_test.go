@@ -0,0 +1,224 @@
+package gohc_test
+
+import (
+	"context"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+var _ = Describe("GrpcMethod", func() {
+	var server *grpc.Server
+	var healthServer *health.Server
+	var lis net.Listener
+	var reflectionStreams int32
+	serve := func(withReflection bool) {
+		var err error
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		atomic.StoreInt32(&reflectionStreams, 0)
+		server = grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			grpc.SetHeader(ctx, metadata.Pairs("x-version", "1.2.0"))
+			return handler(ctx, req)
+		}), grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if strings.HasSuffix(info.FullMethod, "/ServerReflectionInfo") {
+				atomic.AddInt32(&reflectionStreams, 1)
+			}
+			return handler(srv, ss)
+		}))
+		healthServer = health.NewServer()
+		healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_SERVING)
+		healthpb.RegisterHealthServer(server, healthServer)
+		if withReflection {
+			reflection.Register(server)
+		}
+		go server.Serve(lis)
+	}
+	AfterEach(func() {
+		server.Stop()
+		lis.Close()
+	})
+	Context("with server reflection", func() {
+		BeforeEach(func() {
+			serve(true)
+		})
+		It("should call method and assert on response", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:    "grpc.health.v1.Health/Check",
+					Request: `{"service": "test"}`,
+					Assertions: []*HttpAssertion{
+						{Type: HttpAssertionJsonPath, Target: "$.status", Value: "SERVING"},
+						{Type: HttpAssertionHeader, Target: "x-version", Value: `^1\.`, Regex: true},
+						{Type: HttpAssertionBody, Value: `"status":"SERVING"`},
+					},
+				},
+			})
+
+			result, err := hc.CheckWithResult(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+			Expect(string(result.Response)).To(Equal(`{"status":"SERVING"}`))
+		})
+		It("should only ask server reflection on first check", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:    "grpc.health.v1.Health/Check",
+					Request: `{"service": "test"}`,
+				},
+			})
+
+			for i := 0; i < 3; i++ {
+				err := hc.Check(lis.Addr().String())
+				Expect(err).To(BeNil())
+			}
+
+			Expect(atomic.LoadInt32(&reflectionStreams)).To(Equal(int32(1)))
+		})
+		It("should accept method name with dot separator", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name: "grpc.health.v1.Health.Check",
+				},
+			})
+
+			result, err := hc.CheckWithResult(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+			Expect(string(result.Response)).To(Equal(`{"status":"SERVING"}`))
+		})
+		It("should report all failing assertions", func() {
+			healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_NOT_SERVING)
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:    "grpc.health.v1.Health/Check",
+					Request: `{"service": "test"}`,
+					Assertions: []*HttpAssertion{
+						{Type: HttpAssertionJsonPath, Target: "$.status", Value: "SERVING"},
+						{Type: HttpAssertionHeader, Target: "x-version", Value: "2.0.0"},
+					},
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("response assertions failed"))
+			Expect(err.Error()).To(ContainSubstring("json path '$.status' must be 'SERVING': got 'NOT_SERVING'"))
+			Expect(err.Error()).To(ContainSubstring("header 'x-version' must be '2.0.0': got '1.2.0'"))
+		})
+		It("should return an error when call fails", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:    "grpc.health.v1.Health/Check",
+					Request: `{"service": "unknown"}`,
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("gRPC method call failed"))
+			Expect(err.Error()).To(ContainSubstring("NotFound"))
+		})
+		It("should return an error when request does not match message", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:    "grpc.health.v1.Health/Check",
+					Request: `{"unknown": "test"}`,
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("invalid request for grpc.health.v1.HealthCheckRequest"))
+		})
+		It("should return an error when method is streaming", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name: "grpc.health.v1.Health/Watch",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("method grpc.health.v1.Health/Watch is not unary"))
+		})
+		It("should return an error when service is unknown by server", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name: "unknown.Service/Get",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("gRPC server reflection failed for unknown.Service"))
+		})
+	})
+	Context("without server reflection", func() {
+		BeforeEach(func() {
+			serve(false)
+		})
+		It("should use given descriptor set", func() {
+			descriptorSet, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+				File: []*descriptorpb.FileDescriptorProto{
+					protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+				},
+			})
+			Expect(err).To(BeNil())
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name:          "grpc.health.v1.Health/Check",
+					Request:       `{"service": "test"}`,
+					DescriptorSet: descriptorSet,
+					Assertions: []*HttpAssertion{
+						{Type: HttpAssertionJsonPath, Target: "$.status", Value: "SERVING"},
+					},
+				},
+			})
+
+			err = hc.Check(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+		})
+		It("should return an error when server does not implement reflection", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name: "grpc.health.v1.Health/Check",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("gRPC server does not implement server reflection"))
+		})
+		It("should return an error when method name is invalid", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Method: &GrpcMethodOpt{
+					Name: "Check",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("invalid method name 'Check'"))
+		})
+	})
+})
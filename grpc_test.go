@@ -1,17 +1,61 @@
 package gohc_test
 
 import (
+	"context"
 	"crypto/tls"
 	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"io"
 	"log"
 	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+const countingCompressorName = "gohc-counting"
+
+// countingCompressions number of messages compressed by countingCompressor
+var countingCompressions int64
+
+// countingCompressor is gzip counting messages it compresses
+type countingCompressor struct {
+	encoding.Compressor
+}
+
+func (c countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt64(&countingCompressions, 1)
+	return c.Compressor.Compress(w)
+}
+
+func (c countingCompressor) Name() string {
+	return countingCompressorName
+}
+
+func init() {
+	encoding.RegisterCompressor(countingCompressor{encoding.GetCompressor("gzip")})
+}
+
+type staticRpcCredentials map[string]string
+
+func (c staticRpcCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return c, nil
+}
+
+func (c staticRpcCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
 var _ = Describe("Grpc", func() {
 	var server *grpc.Server
 	var healthServer *health.Server
@@ -71,6 +115,205 @@ var _ = Describe("Grpc", func() {
 				Expect(err).To(BeNil())
 			})
 		})
+		It("should check through http connect proxy", func() {
+			proxyServer, err := testhelpers.NewHttpConnectProxy("user", "pass")
+			Expect(err).To(BeNil())
+			defer proxyServer.Close()
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Proxy: &ProxyOpt{
+					Url: "http://user:pass@" + proxyServer.Addr(),
+				},
+			})
+
+			err = hc.Check(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+			Expect(proxyServer.Connections()).To(Equal(int64(1)))
+		})
+		When("multiple services are given", func() {
+			BeforeEach(func() {
+				healthServer.SetServingStatus("svc1", healthpb.HealthCheckResponse_SERVING)
+				healthServer.SetServingStatus("svc2", healthpb.HealthCheckResponse_SERVING)
+				healthServer.SetServingStatus("svc3", healthpb.HealthCheckResponse_NOT_SERVING)
+			})
+			It("should give result of each service", func() {
+				hc := NewGrpcHealthCheck(&GrpcOpt{ServiceNames: []string{"svc1", "svc3", "unknown"}})
+
+				result, err := hc.CheckWithResult(lis.Addr().String())
+
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("policy all not satisfied, 1/3 services serving"))
+				Expect(err.Error()).To(ContainSubstring("- 'svc3': received gRPC status code: NOT_SERVING"))
+				Expect(result.Services).To(HaveLen(3))
+				Expect(result.Services[0].ServiceName).To(Equal("svc1"))
+				Expect(result.Services[0].Status).To(Equal(healthpb.HealthCheckResponse_SERVING))
+				Expect(result.Services[0].Err).To(BeNil())
+				Expect(result.Services[1].Status).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+				Expect(result.Services[2].Err.Error()).To(ContainSubstring("NotFound"))
+			})
+			It("should return nil when all services are serving", func() {
+				hc := NewGrpcHealthCheck(&GrpcOpt{ServiceNames: []string{"svc1", "svc2"}})
+
+				err := hc.Check(lis.Addr().String())
+
+				Expect(err).To(BeNil())
+			})
+			It("should return nil with policy any when one service is serving", func() {
+				hc := NewGrpcHealthCheck(&GrpcOpt{
+					ServiceNames:  []string{"svc1", "svc3", "unknown"},
+					ServicePolicy: GrpcServicePolicyAny,
+				})
+
+				err := hc.Check(lis.Addr().String())
+
+				Expect(err).To(BeNil())
+			})
+			It("should apply quorum policy", func() {
+				hc := NewGrpcHealthCheck(&GrpcOpt{
+					ServiceNames:  []string{"svc1", "svc2", "svc3"},
+					ServicePolicy: GrpcServicePolicyQuorum,
+				})
+				Expect(hc.Check(lis.Addr().String())).To(BeNil())
+
+				hc = NewGrpcHealthCheck(&GrpcOpt{
+					ServiceNames:  []string{"svc1", "svc3", "unknown"},
+					ServicePolicy: GrpcServicePolicyQuorum,
+				})
+				err := hc.Check(lis.Addr().String())
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("policy quorum not satisfied, 1/3 services serving"))
+			})
+		})
+		It("should reuse connection between checks until closed", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				ReuseConnection: true,
+				KeepaliveTime:   10 * time.Second,
+			})
+			defer hc.Close()
+
+			result, err := hc.CheckWithResult(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(result.ConnReused).To(BeFalse())
+
+			result, err = hc.CheckWithResult(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(result.ConnReused).To(BeTrue())
+
+			hc.Close()
+			result, err = hc.CheckWithResult(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(result.ConnReused).To(BeFalse())
+		})
+		It("should replace cached connection in transient failure after server restart", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				ReuseConnection: true,
+			})
+			defer hc.Close()
+			addr := lis.Addr().String()
+
+			result, err := hc.CheckWithResult(addr)
+			Expect(err).To(BeNil())
+			Expect(result.ConnState).To(Equal(connectivity.Ready))
+
+			server.Stop()
+			Eventually(func() connectivity.State {
+				result, err := hc.CheckWithResult(addr)
+				Expect(err).ToNot(BeNil())
+				return result.ConnState
+			}).Should(Equal(connectivity.TransientFailure))
+
+			lis, err = net.Listen("tcp4", addr)
+			Expect(err).To(BeNil())
+			server = grpc.NewServer()
+			healthpb.RegisterHealthServer(server, healthServer)
+			go server.Serve(lis)
+
+			result, err = hc.CheckWithResult(addr)
+			Expect(err).To(BeNil())
+			Expect(result.ConnReused).To(BeFalse())
+			Expect(result.ConnState).To(Equal(connectivity.Ready))
+		})
+	})
+	Context("Request options", func() {
+		var mdMu sync.Mutex
+		var receivedMd metadata.MD
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("tcp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			server = grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				mdMu.Lock()
+				receivedMd, _ = metadata.FromIncomingContext(ctx)
+				mdMu.Unlock()
+				return handler(ctx, req)
+			}))
+			healthServer = health.NewServer()
+			healthpb.RegisterHealthServer(server, healthServer)
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Stop()
+			lis.Close()
+		})
+		It("should send metadata, per rpc credentials and authority", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Metadata:          metadata.Pairs("X-Tenant", "acme"),
+				PerRPCCredentials: staticRpcCredentials{"x-token": "secret"},
+				Authority:         "backend.gohc.test",
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+			mdMu.Lock()
+			defer mdMu.Unlock()
+			Expect(receivedMd.Get("x-tenant")).To(Equal([]string{"acme"}))
+			Expect(receivedMd.Get("x-token")).To(Equal([]string{"secret"}))
+			Expect(receivedMd.Get(":authority")).To(Equal([]string{"backend.gohc.test"}))
+		})
+		It("should compress requests with given compressor", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Compression: countingCompressorName,
+			})
+			before := atomic.LoadInt64(&countingCompressions)
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).To(BeNil())
+			Expect(atomic.LoadInt64(&countingCompressions)).To(BeNumerically(">", before))
+		})
+		It("should return an error when compressor is not registered", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				Compression: "unknown",
+			})
+
+			err := hc.Check(lis.Addr().String())
+
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("compressor unknown is not registered"))
+		})
+	})
+	Context("Check Unix Socket", func() {
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("unix", filepath.Join(GinkgoT().TempDir(), "grpc.sock"))
+			Expect(err).To(BeNil())
+			server = grpc.NewServer()
+			healthServer = health.NewServer()
+			healthpb.RegisterHealthServer(server, healthServer)
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Stop()
+			lis.Close()
+		})
+		It("should return nil on the most basic test", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{})
+
+			err := hc.Check(UnixHostPrefix + lis.Addr().String())
+
+			Expect(err).To(BeNil())
+		})
 	})
 	Context("Check Tls", func() {
 		BeforeEach(func() {
@@ -0,0 +1,288 @@
+package gohc
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// GrpcWatcherOpt Describes how a GrpcWatcher monitors hosts.
+type GrpcWatcherOpt struct {
+	// Grpc options to connect and request health of hosts, Timeout applies to first status and to polled checks.
+	// Only ServiceName is watched, ServiceNames and Method are not supported and make checks return an error.
+	Grpc *GrpcOpt
+	// OnChange if set, is called on each status transition of a host.
+	OnChange func(host string, status *GrpcWatchStatus)
+	// MinBackoff delay before reconnecting after a connection or stream failure. If left empty (default to 1s)
+	MinBackoff time.Duration
+	// MaxBackoff max delay before reconnecting, delay doubles after each consecutive failure. If left empty (default to 30s)
+	MaxBackoff time.Duration
+	// PollInterval interval between unary Check calls when server does not implement Watch. If left empty (default to 10s)
+	PollInterval time.Duration
+}
+
+// GrpcWatchStatus gives last status known for a host.
+type GrpcWatchStatus struct {
+	// Status sent by server, UNKNOWN if Err is set
+	Status healthpb.HealthCheckResponse_ServingStatus
+	// Err connection or stream error
+	Err error
+	// Polling true if server does not implement Watch and status comes from polled Check
+	Polling bool
+	// Since time of transition to this status
+	Since time.Time
+}
+
+func (s *GrpcWatchStatus) sameAs(other *GrpcWatchStatus) bool {
+	return other != nil && s.Status == other.Status && (s.Err == nil) == (other.Err == nil) && s.Polling == other.Polling
+}
+
+type grpcHostWatch struct {
+	cancel context.CancelFunc
+	status *GrpcWatchStatus
+	// closed when first status is known
+	ready chan struct{}
+}
+
+// GrpcWatcher keeps one connection per host and subscribes to status changes with gRPC health Watch,
+// it reconnects with backoff and falls back to polling Check when Watch is not implemented.
+// GrpcWatcher is a HealthChecker giving last status known, watch starts on first check of a host.
+type GrpcWatcher struct {
+	opt     *GrpcWatcherOpt
+	hc      *GrpcHealthCheck
+	mu      sync.Mutex
+	watches map[string]*grpcHostWatch
+	optErr  error
+}
+
+func NewGrpcWatcher(opt *GrpcWatcherOpt) *GrpcWatcher {
+	grpcOpt := opt.Grpc
+	if grpcOpt == nil {
+		grpcOpt = &GrpcOpt{}
+	}
+	var err error
+	if len(grpcOpt.ServiceNames) > 0 || grpcOpt.Method != nil {
+		err = fmt.Errorf("ServiceNames and Method are not supported by gRPC watcher")
+	}
+	return &GrpcWatcher{
+		opt:     opt,
+		hc:      NewGrpcHealthCheck(grpcOpt),
+		watches: make(map[string]*grpcHostWatch),
+		optErr:  err,
+	}
+}
+
+// Watch starts watching host in background until Unwatch or Close is called, does nothing if host is already watched
+// or if options are not supported.
+func (w *GrpcWatcher) Watch(host string) {
+	if w.optErr != nil {
+		return
+	}
+	w.watch(host)
+}
+
+func (w *GrpcWatcher) watch(host string) *grpcHostWatch {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hw, ok := w.watches[host]; ok {
+		return hw
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hw := &grpcHostWatch{
+		cancel: cancel,
+		ready:  make(chan struct{}),
+	}
+	w.watches[host] = hw
+	go w.run(ctx, host, hw)
+	return hw
+}
+
+// Unwatch stops watching host and closes its connection.
+func (w *GrpcWatcher) Unwatch(host string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if hw, ok := w.watches[host]; ok {
+		hw.cancel()
+		delete(w.watches, host)
+	}
+}
+
+// Close stops watching all hosts.
+func (w *GrpcWatcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for host, hw := range w.watches {
+		hw.cancel()
+		delete(w.watches, host)
+	}
+}
+
+// Status gives last status known for host, nil if host is not watched or no status is known yet.
+func (w *GrpcWatcher) Status(host string) *GrpcWatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	hw, ok := w.watches[host]
+	if !ok || hw.status == nil {
+		return nil
+	}
+	status := *hw.status
+	return &status
+}
+
+// Check starts watching host if not already done and gives an error if last status known is not SERVING,
+// on first check it waits for first status until Timeout.
+func (w *GrpcWatcher) Check(host string) error {
+	if w.optErr != nil {
+		return w.optErr
+	}
+	hw := w.watch(host)
+	timer := time.NewTimer(w.hc.timeout())
+	defer timer.Stop()
+	select {
+	case <-hw.ready:
+	case <-timer.C:
+		return fmt.Errorf("gRPC health check timeout: no status received within %s", w.hc.timeout())
+	}
+	status := w.Status(host)
+	if status == nil {
+		return fmt.Errorf("host %s is not watched", host)
+	}
+	if status.Err != nil {
+		return status.Err
+	}
+	if status.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("received gRPC status code: %v", status.Status)
+	}
+	return nil
+}
+
+func (w *GrpcWatcher) update(ctx context.Context, host string, hw *grpcHostWatch, status *GrpcWatchStatus) {
+	w.mu.Lock()
+	// host has been unwatched
+	if ctx.Err() != nil {
+		w.mu.Unlock()
+		return
+	}
+	if status.sameAs(hw.status) {
+		w.mu.Unlock()
+		return
+	}
+	first := hw.status == nil
+	status.Since = time.Now()
+	hw.status = status
+	w.mu.Unlock()
+	if first {
+		close(hw.ready)
+	}
+	if w.opt.OnChange != nil {
+		statusCopy := *status
+		w.opt.OnChange(host, &statusCopy)
+	}
+}
+
+func (w *GrpcWatcher) run(ctx context.Context, host string, hw *grpcHostWatch) {
+	minBackoff := w.opt.MinBackoff
+	if minBackoff == 0 {
+		minBackoff = 1 * time.Second
+	}
+	maxBackoff := w.opt.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = 30 * time.Second
+	}
+	backoff := minBackoff
+	for {
+		var received bool
+		conn, err := w.hc.makeGrpcConn(host)
+		if err == nil {
+			received, err = w.watchConn(ctx, host, hw, conn)
+			conn.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		w.update(ctx, host, hw, &GrpcWatchStatus{
+			Status: healthpb.HealthCheckResponse_UNKNOWN,
+			Err:    err,
+		})
+		// connection was healthy, failure is not consecutive
+		if received {
+			backoff = minBackoff
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watchConn streams statuses until stream fails, it gives true if at least one status has been received.
+func (w *GrpcWatcher) watchConn(ctx context.Context, host string, hw *grpcHostWatch, conn *grpc.ClientConn) (bool, error) {
+	ctx = w.hc.outgoingContext(ctx)
+	client := healthpb.NewHealthClient(conn)
+	req := &healthpb.HealthCheckRequest{
+		Service: w.hc.opt.ServiceName,
+	}
+	stream, err := client.Watch(ctx, req)
+	if err != nil {
+		return false, fmt.Errorf("gRPC health watch failed: %w", err)
+	}
+	received := false
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if status.Code(err) == codes.Unimplemented {
+				return w.poll(ctx, host, hw, client, req)
+			}
+			return received, fmt.Errorf("gRPC health watch failed: %w", err)
+		}
+		received = true
+		w.update(ctx, host, hw, &GrpcWatchStatus{
+			Status: resp.Status,
+		})
+	}
+}
+
+// poll calls Check at PollInterval until it fails, it gives true if at least one status has been received.
+func (w *GrpcWatcher) poll(ctx context.Context, host string, hw *grpcHostWatch, client healthpb.HealthClient, req *healthpb.HealthCheckRequest) (bool, error) {
+	interval := w.opt.PollInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	received := false
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, w.hc.timeout())
+		resp, err := client.Check(checkCtx, req)
+		cancel()
+		if err != nil {
+			return received, fmt.Errorf("gRPC health check failed: %w", err)
+		}
+		received = true
+		w.update(ctx, host, hw, &GrpcWatchStatus{
+			Status:  resp.Status,
+			Polling: true,
+		})
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *GrpcWatcher) String() string {
+	return fmt.Sprintf("GrpcWatcher, service name '%s'", w.hc.opt.ServiceName)
+}
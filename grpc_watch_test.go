@@ -0,0 +1,151 @@
+package gohc_test
+
+import (
+	"context"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"sync"
+	"time"
+)
+
+// checkOnlyHealthServer does not implement Watch
+type checkOnlyHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (s *checkOnlyHealthServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// statusRecorder records statuses given to OnChange
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses []healthpb.HealthCheckResponse_ServingStatus
+}
+
+func (r *statusRecorder) onChange(_ string, status *GrpcWatchStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, status.Status)
+}
+
+func (r *statusRecorder) recorded() []healthpb.HealthCheckResponse_ServingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]healthpb.HealthCheckResponse_ServingStatus{}, r.statuses...)
+}
+
+var _ = Describe("GrpcWatcher", func() {
+	var server *grpc.Server
+	var healthServer *health.Server
+	var lis net.Listener
+	var watcher *GrpcWatcher
+	var recorder *statusRecorder
+	serve := func(address string, healthImpl healthpb.HealthServer) {
+		var err error
+		lis, err = net.Listen("tcp4", address)
+		Expect(err).To(BeNil())
+		server = grpc.NewServer()
+		healthpb.RegisterHealthServer(server, healthImpl)
+		go server.Serve(lis)
+	}
+	BeforeEach(func() {
+		recorder = &statusRecorder{}
+		healthServer = health.NewServer()
+		watcher = NewGrpcWatcher(&GrpcWatcherOpt{
+			Grpc: &GrpcOpt{
+				ServiceName: "test",
+			},
+			OnChange:     recorder.onChange,
+			MinBackoff:   50 * time.Millisecond,
+			MaxBackoff:   100 * time.Millisecond,
+			PollInterval: 50 * time.Millisecond,
+		})
+	})
+	AfterEach(func() {
+		watcher.Close()
+		server.Stop()
+		lis.Close()
+	})
+	It("should report status transitions as they are streamed", func() {
+		serve("127.0.0.1:0", healthServer)
+		healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_SERVING)
+
+		err := watcher.Check(lis.Addr().String())
+		Expect(err).To(BeNil())
+
+		healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_NOT_SERVING)
+		Eventually(recorder.recorded).Should(Equal([]healthpb.HealthCheckResponse_ServingStatus{
+			healthpb.HealthCheckResponse_SERVING,
+			healthpb.HealthCheckResponse_NOT_SERVING,
+		}))
+		err = watcher.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("NOT_SERVING"))
+	})
+	It("should return an error when service names or method are set", func() {
+		multiWatcher := NewGrpcWatcher(&GrpcWatcherOpt{
+			Grpc: &GrpcOpt{
+				ServiceNames: []string{"test", "other"},
+			},
+		})
+		defer multiWatcher.Close()
+
+		err := multiWatcher.Check("127.0.0.1:1")
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("not supported by gRPC watcher"))
+		Expect(multiWatcher.Status("127.0.0.1:1")).To(BeNil())
+	})
+	It("should report unknown service", func() {
+		serve("127.0.0.1:0", healthServer)
+
+		err := watcher.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("SERVICE_UNKNOWN"))
+	})
+	It("should reconnect with backoff when connection is lost", func() {
+		serve("127.0.0.1:0", healthServer)
+		healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_SERVING)
+		address := lis.Addr().String()
+		Expect(watcher.Check(address)).To(BeNil())
+
+		server.Stop()
+		Eventually(func() error {
+			return watcher.Status(address).Err
+		}).ShouldNot(BeNil())
+		Expect(watcher.Check(address)).ToNot(BeNil())
+
+		serve(address, healthServer)
+		Eventually(func() error {
+			return watcher.Check(address)
+		}).Should(BeNil())
+		Expect(recorder.recorded()).To(Equal([]healthpb.HealthCheckResponse_ServingStatus{
+			healthpb.HealthCheckResponse_SERVING,
+			healthpb.HealthCheckResponse_UNKNOWN,
+			healthpb.HealthCheckResponse_SERVING,
+		}))
+	})
+	It("should poll check when watch is not implemented", func() {
+		serve("127.0.0.1:0", &checkOnlyHealthServer{})
+
+		err := watcher.Check(lis.Addr().String())
+		Expect(err).To(BeNil())
+		Expect(watcher.Status(lis.Addr().String()).Polling).To(BeTrue())
+	})
+	It("should stop watching when unwatched", func() {
+		serve("127.0.0.1:0", healthServer)
+		healthServer.SetServingStatus("test", healthpb.HealthCheckResponse_SERVING)
+		watcher.Watch(lis.Addr().String())
+		Eventually(func() *GrpcWatchStatus {
+			return watcher.Status(lis.Addr().String())
+		}).ShouldNot(BeNil())
+
+		watcher.Unwatch(lis.Addr().String())
+		Expect(watcher.Status(lis.Addr().String())).To(BeNil())
+	})
+})
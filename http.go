@@ -2,13 +2,22 @@ package gohc
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/http2"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -37,6 +46,44 @@ var (
 	}
 )
 
+type HttpRedirectPolicy int32
+
+const (
+	// HttpRedirectFollow follows redirects up to MaxRedirects (default behavior)
+	HttpRedirectFollow HttpRedirectPolicy = 0
+	// HttpRedirectNever never follows redirects, the redirect response is checked
+	HttpRedirectNever HttpRedirectPolicy = 1
+	// HttpRedirectSameHost follows redirects up to MaxRedirects only when they stay on the same host,
+	// a redirect to another host is not followed and is checked
+	HttpRedirectSameHost HttpRedirectPolicy = 2
+)
+
+type HttpConnectionMode int32
+
+const (
+	// HttpConnectionReuse reuses connections between checks (default behavior)
+	HttpConnectionReuse HttpConnectionMode = 0
+	// HttpConnectionNew always uses a new connection for each check
+	HttpConnectionNew HttpConnectionMode = 1
+	// HttpConnectionReuseMaxAge reuses connections between checks until they are older than ConnectionMaxAge.
+	// Not supported with CodecClientType_HTTP3 which always reuses connections in this mode.
+	HttpConnectionReuseMaxAge HttpConnectionMode = 2
+)
+
+// HttpResult gives details on a http check.
+type HttpResult struct {
+	// StatusCode of the final response, 0 if no response was received
+	StatusCode int
+	// Protocol negotiated for the final response (e.g.: HTTP/1.1, HTTP/2.0, HTTP/3.0)
+	Protocol string
+	// ConnReused true if the connection used was reused from a previous check
+	ConnReused bool
+	// DnsDuration time spent resolving host, 0 if no resolution was made (e.g.: reused connection)
+	DnsDuration time.Duration
+	// Duration of the check
+	Duration time.Duration
+}
+
 // HttpOpt Describes the health check policy for a given endpoint.
 type HttpOpt struct {
 	// The value of the host header in the HTTP health check request
@@ -55,8 +102,24 @@ type HttpOpt struct {
 	// 200-only policy - 200 must be included explicitly as needed. Ranges follow half-open
 	// semantics of Int64Range. The start and end of each
 	ExpectedStatuses *IntRange
+	// ExpectedStatusRanges a list of ranges of HTTP response statuses considered healthy,
+	// they are added to ExpectedStatuses if set (e.g.: 200-299, 301 and 401).
+	ExpectedStatusRanges []*IntRange
+	// RetriableStatuses a list of ranges of HTTP response statuses which are considered as retriable failures
+	// instead of failures. A host responding with a retriable status is only considered unhealthy after
+	// UnhealthyThreshold consecutive retriable failures, before that check returns a WarnError.
+	// Expected statuses take precedence over retriable statuses.
+	RetriableStatuses []*IntRange
+	// UnhealthyThreshold number of consecutive retriable failures before considering host unhealthy,
+	// failures of a host not checked for 10 minutes are forgotten. If left empty (default to 1)
+	UnhealthyThreshold uint32
 	// Use specified application protocol for health checks.
+	// HTTP2 without tls uses cleartext HTTP2 (h2c) with prior knowledge.
+	// HTTP3 requires tls to be enabled.
 	CodecClientType CodecClientType
+	// StrictProtocol set to true to fail when the negotiated protocol differs from CodecClientType
+	// (e.g.: server only answering in HTTP1 when HTTP2 is requested).
+	StrictProtocol bool
 	// HTTP Method that will be used for health checking, default is "GET".
 	// If a non-200 response is expected by the method, it needs to be set in expected_statuses.
 	Method string
@@ -69,109 +132,655 @@ type HttpOpt struct {
 	// AltPort specifies the port to use for gRPC health check requests.
 	// If left empty it taks the port from host during check.
 	AltPort uint32
+	// RedirectPolicy specifies how redirects are followed, default to HttpRedirectFollow.
+	RedirectPolicy HttpRedirectPolicy
+	// MaxRedirects max number of redirects to follow before failing. If left empty (default to 10)
+	MaxRedirects int
+	// FinalUrlPattern if set, the url of the final response (after redirects) must match this regular expression.
+	FinalUrlPattern string
+	// MaxBodyBytes max number of bytes read from response body, assertions are made on the truncated body.
+	// If left empty there is no limit. When only Receive is set, body reading stops as soon as payload is found.
+	MaxBodyBytes int64
+	// Templated set to true to render Path, Host, Headers values, Send and Receive text payloads as go templates
+	// with TemplateVars (e.g.: Path: "/health?nonce={{.Nonce}}", Receive: "{{.Nonce}}").
+	Templated bool
+	// Auth if set, gives credentials headers added to each request (e.g.: BasicAuth, BearerTokenFile, OAuth2ClientCredentials).
+	Auth AuthProvider
+	// Signer if set, signs each request just before it is sent.
+	Signer RequestSigner
+	// Proxy if set, connections are made through this proxy (with CONNECT method for http proxy).
+	// Not supported with CodecClientType_HTTP3.
+	Proxy *ProxyOpt
+	// DisableEnvProxy set to true to not use proxy set in environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY).
+	// Environment variables are read when the health check is created, unix socket hosts are never proxied.
+	DisableEnvProxy bool
+	// ProxyProtocol if set, a PROXY protocol header is sent at the beginning of each connection, before tls.
+	// Not supported with CodecClientType_HTTP3.
+	ProxyProtocol *ProxyProtocolOpt
+	// Network if set, describes source address, interface and socket options used by connections.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
+	// ConnectionMode specifies if connections are reused between checks, default to HttpConnectionReuse.
+	ConnectionMode HttpConnectionMode
+	// ConnectionMaxAge max age of a connection to be reused with HttpConnectionReuseMaxAge.
+	// If left empty (default to 1m)
+	ConnectionMaxAge time.Duration
+	// Assertions to make on response, all must pass and all failing assertions are reported in error.
+	Assertions []*HttpAssertion
+	// WarnLatency if set, a successful check taking more than this duration returns a WarnError.
+	WarnLatency time.Duration
 }
 
 type HttpHealthCheck struct {
-	httpClient *http.Client
-	opt        *HttpOpt
+	httpClient       *http.Client
+	opt              *HttpOpt
+	expectedStatuses []*IntRange
+	finalUrlRegex    *regexp.Regexp
+	assertions       []*httpAssertionMatcher
+	optErr           error
+	conns            *connTracker
+	// consecutive retriable failures by host
+	retriableFailures map[string]*retriableFailures
+	retriableSweep    time.Time
+	retriableMu       sync.Mutex
+}
+
+// retriableFailuresExpiry duration after which retriable failures of a host not checked anymore are forgotten
+const retriableFailuresExpiry = 10 * time.Minute
+
+type retriableFailures struct {
+	count uint32
+	last  time.Time
 }
 
 func NewHttpHealthCheck(opt *HttpOpt) *HttpHealthCheck {
-	return &HttpHealthCheck{
-		httpClient: makeHttpClient(opt.CodecClientType, opt.TlsConfig, opt.Timeout),
-		opt:        opt,
+	assertions, err := makeHttpAssertionMatchers(opt.Assertions)
+	var finalUrlRegex *regexp.Regexp
+	if err == nil && opt.FinalUrlPattern != "" {
+		finalUrlRegex, err = regexp.Compile(opt.FinalUrlPattern)
+		if err != nil {
+			err = fmt.Errorf("invalid final url pattern: %w", err)
+		}
+	}
+	var expectedStatuses []*IntRange
+	if opt.ExpectedStatuses != nil {
+		expectedStatuses = append(expectedStatuses, opt.ExpectedStatuses)
+	}
+	expectedStatuses = append(expectedStatuses, opt.ExpectedStatusRanges...)
+	if len(expectedStatuses) == 0 {
+		expectedStatuses = []*IntRange{{Start: 200, End: 201}}
+	}
+	if err == nil {
+		err = validateHttpOpt(opt)
+	}
+	hc := &HttpHealthCheck{
+		opt:               opt,
+		expectedStatuses:  expectedStatuses,
+		finalUrlRegex:     finalUrlRegex,
+		assertions:        assertions,
+		optErr:            err,
+		retriableFailures: make(map[string]*retriableFailures),
+	}
+	dial, err := makeHttpDial(opt)
+	if err != nil && hc.optErr == nil {
+		hc.optErr = err
+	}
+	if opt.ConnectionMode == HttpConnectionReuseMaxAge {
+		maxAge := opt.ConnectionMaxAge
+		if maxAge == 0 {
+			maxAge = 1 * time.Minute
+		}
+		hc.conns = newConnTracker(maxAge)
+		dial = hc.conns.wrapDial(dial)
 	}
+	hc.httpClient = makeHttpClient(opt, dial)
+	hc.httpClient.CheckRedirect = hc.checkRedirect
+	return hc
+}
+
+// validateHttpOpt gives an error if options can not be used together
+func validateHttpOpt(opt *HttpOpt) error {
+	if opt.CodecClientType != CodecClientType_HTTP3 {
+		return nil
+	}
+	if !opt.TlsEnabled {
+		return fmt.Errorf("HTTP3 requires tls to be enabled")
+	}
+	if opt.Proxy != nil {
+		return fmt.Errorf("proxy is not supported with HTTP3")
+	}
+	if opt.ProxyProtocol != nil {
+		return fmt.Errorf("PROXY protocol is not supported with HTTP3")
+	}
+	return nil
+}
+
+// makeHttpDial gives dial function of http clients made from opt, proxy is not used if it gives an error
+func makeHttpDial(opt *HttpOpt) (dialContextFunc, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	dial := makeNetworkDial(opt.Network, dialer)
+	var err error
+	if opt.Proxy != nil {
+		var proxyDial dialContextFunc
+		proxyDial, err = makeProxyDial(opt.Proxy, dial)
+		if err == nil {
+			dial = proxyDial
+		}
+	}
+	if opt.Resolver != nil {
+		dial = wrapDialResolver(newResolver(opt.Resolver), dial)
+	}
+	if opt.ProxyProtocol != nil {
+		dial = wrapDialProxyProtocol(opt.ProxyProtocol, dial)
+	}
+	return dialUnixUrlHost(dial), err
+}
+
+func (h *HttpHealthCheck) checkRedirect(req *http.Request, via []*http.Request) error {
+	if h.opt.RedirectPolicy == HttpRedirectNever {
+		return http.ErrUseLastResponse
+	}
+	if h.opt.RedirectPolicy == HttpRedirectSameHost && req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+	maxRedirects := h.opt.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = 10
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return nil
 }
 
 func (h *HttpHealthCheck) Check(host string) error {
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// Close closes idle connections kept for reuse between checks.
+func (h *HttpHealthCheck) Close() {
+	h.httpClient.CloseIdleConnections()
+}
+
+// CheckWithResult runs the check as Check does and gives details on the check.
+func (h *HttpHealthCheck) CheckWithResult(host string) (*HttpResult, error) {
+	start := time.Now()
+	result := &HttpResult{}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	return result, checkLatency(start, h.opt.WarnLatency)
+}
+
+func (h *HttpHealthCheck) check(host string, result *HttpResult) error {
+	if h.optErr != nil {
+		return h.optErr
+	}
 	var err error
 	host, err = FormatHost(host, h.opt.AltPort)
 	if err != nil {
 		return err
 	}
+	parts, err := h.requestParts(host)
+	if err != nil {
+		return err
+	}
+	req, err := newHttpRequest(h.opt, host, parts)
+	if err != nil {
+		return err
+	}
+
+	var dnsStart time.Time
+	// connections used by this check (one per redirect), they are released when response body is done
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			result.ConnReused = info.Reused
+			if h.conns != nil {
+				releases = append(releases, h.conns.acquire(info.Conn))
+			}
+		},
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			result.DnsDuration += time.Since(dnsStart)
+		},
+	}))
+	if h.conns != nil {
+		h.conns.closeExpired()
+	}
+	resp, err := h.httpClient.Do(req)
+	if h.opt.ConnectionMode == HttpConnectionNew {
+		// transports without keep alive option
+		if closer, ok := h.httpClient.Transport.(interface{ CloseIdleConnections() }); ok {
+			defer closer.CloseIdleConnections()
+		}
+	}
+	if err != nil {
+		h.resetRetriableFailures(host)
+		return err
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Protocol = resp.Proto
+	if h.opt.StrictProtocol && resp.ProtoMajor != int(h.opt.CodecClientType)+1 {
+		return fmt.Errorf("negotiated protocol %s differs from requested %s",
+			resp.Proto, CodecClientType_name[int32(h.opt.CodecClientType)])
+	}
+	err = h.checkStatus(host, int64(resp.StatusCode))
+	if err != nil {
+		return err
+	}
+	if h.finalUrlRegex != nil && !h.finalUrlRegex.MatchString(resp.Request.URL.String()) {
+		return fmt.Errorf("final url %s does not match %s", resp.Request.URL.String(), h.opt.FinalUrlPattern)
+	}
+	_, err = checkHttpBody(resp, parts.receive, h.assertions, h.opt.MaxBodyBytes, false)
+	return err
+}
+
+// httpRequestParts are options used to build request and check response, rendered if options are templated
+type httpRequestParts struct {
+	method  string
+	path    string
+	host    string
+	headers http.Header
+	send    *Payload
+	receive *Payload
+}
+
+func (h *HttpHealthCheck) requestParts(host string) (*httpRequestParts, error) {
+	parts := &httpRequestParts{
+		method:  h.opt.Method,
+		path:    h.opt.Path,
+		host:    h.opt.Host,
+		headers: h.opt.Headers,
+		send:    h.opt.Send,
+		receive: h.opt.Receive,
+	}
+	if !h.opt.Templated {
+		return parts, nil
+	}
+	vars, err := newTemplateVars(host)
+	if err != nil {
+		return nil, err
+	}
+	parts.path, err = vars.render(parts.path)
+	if err != nil {
+		return nil, err
+	}
+	parts.host, err = vars.render(parts.host)
+	if err != nil {
+		return nil, err
+	}
+	parts.headers, err = vars.renderHeader(parts.headers)
+	if err != nil {
+		return nil, err
+	}
+	parts.send, err = vars.renderPayload(parts.send)
+	if err != nil {
+		return nil, err
+	}
+	parts.receive, err = vars.renderPayload(parts.receive)
+	if err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// newHttpRequest gives request to host made from parts, with credentials of opt.Auth and signed by opt.Signer
+func newHttpRequest(opt *HttpOpt, host string, parts *httpRequestParts) (*http.Request, error) {
 	protocol := "http"
-	if h.opt.TlsEnabled {
+	if opt.TlsEnabled {
 		protocol = "https"
 	}
-
-	path := h.opt.Path
+	path := parts.path
 	if path == "" {
 		path = "/"
 	}
-
-	url := fmt.Sprintf("%s://%s%s", protocol, host, path)
-
+	urlHost := host
+	if IsUnixHost(host) {
+		if opt.CodecClientType == CodecClientType_HTTP3 {
+			return nil, fmt.Errorf("HTTP3 is not supported over unix socket")
+		}
+		urlHost = unixUrlHost(host)
+	}
 	method := http.MethodGet
-	if h.opt.Method != "" {
-		method = strings.ToUpper(h.opt.Method)
+	if parts.method != "" {
+		method = strings.ToUpper(parts.method)
 	}
 	var body io.Reader
-	if h.opt.Send != nil {
-		body = bytes.NewReader(h.opt.Send.GetData())
+	var bodyData []byte
+	if parts.send != nil {
+		bodyData = parts.send.GetData()
+		body = bytes.NewReader(bodyData)
 	}
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequest(method, fmt.Sprintf("%s://%s%s", protocol, urlHost, path), body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if parts.host != "" {
+		req.Host = parts.host
+	} else if IsUnixHost(host) {
+		req.Host = "localhost"
 	}
-	if h.opt.Host != "" {
-		req.Host = h.opt.Host
+	if parts.headers != nil {
+		req.Header = parts.headers.Clone()
+	}
+	if opt.Auth != nil {
+		authHeaders, err := opt.Auth.AuthHeaders(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("fail to get credentials: %w", err)
+		}
+		for key, values := range authHeaders {
+			req.Header[key] = values
+		}
+	}
+	if opt.Signer != nil {
+		err = opt.Signer.SignRequest(req, bodyData)
+		if err != nil {
+			return nil, fmt.Errorf("fail to sign request: %w", err)
+		}
 	}
-	if h.opt.Headers != nil {
-		req.Header = h.opt.Headers
+	return req, nil
+}
+
+// checkHttpStatus gives an error if statusCode is not in expected ranges
+func checkHttpStatus(expected []*IntRange, statusCode int64) error {
+	if intRangesContains(expected, statusCode) {
+		return nil
 	}
+	return fmt.Errorf("unexpected status code, got %d not in range %s", statusCode, intRangesString(expected))
+}
 
-	resp, err := h.httpClient.Do(req)
+// checkHttpBody reads response body, up to maxBodyBytes if set, and checks it contains receive and passes assertions.
+// Body is read entirely if needFullBody or an assertion needs it, until receive is found otherwise.
+func checkHttpBody(resp *http.Response, receive *Payload, assertions []*httpAssertionMatcher, maxBodyBytes int64, needFullBody bool) ([]byte, error) {
+	for _, assertion := range assertions {
+		needFullBody = needFullBody || assertion.needBody()
+	}
+	var bodyReader io.Reader = resp.Body
+	if maxBodyBytes > 0 {
+		bodyReader = io.LimitReader(resp.Body, maxBodyBytes)
+	}
+	var b []byte
+	var err error
+	switch {
+	case needFullBody:
+		b, err = io.ReadAll(bodyReader)
+	case receive != nil:
+		b, err = readUntilContains(bodyReader, receive.GetData())
+	}
 	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if receive != nil && !bytes.Contains(b, receive.GetData()) {
+		return nil, fmt.Errorf("response body does not contains expected data")
+	}
+	var resultErr string
+	for _, assertion := range assertions {
+		ok, got := assertion.match(resp.Header, b)
+		if !ok {
+			resultErr = fmt.Sprintf("%s- %s: %s\n", resultErr, assertion.assertion, got)
+		}
+	}
+	if resultErr != "" {
+		return nil, fmt.Errorf("response assertions failed:\n%s", resultErr)
+	}
+	return b, nil
+}
+
+func (h *HttpHealthCheck) checkStatus(host string, statusCode int64) error {
+	err := checkHttpStatus(h.expectedStatuses, statusCode)
+	if err == nil {
+		h.resetRetriableFailures(host)
+		return nil
+	}
+	if !intRangesContains(h.opt.RetriableStatuses, statusCode) {
+		h.resetRetriableFailures(host)
 		return err
 	}
-	defer resp.Body.Close()
-	start := int64(200)
-	end := int64(201)
-	if h.opt.ExpectedStatuses != nil {
-		start = h.opt.ExpectedStatuses.Start
-		end = h.opt.ExpectedStatuses.End
-	}
-	statusCode := int64(resp.StatusCode)
-	if statusCode < start || statusCode >= end {
-		return fmt.Errorf("unexpected status code, got %d not in range [%d, %d)", statusCode, start, end)
-	}
-	if h.opt.Receive != nil {
-		b, err := io.ReadAll(resp.Body)
+	threshold := h.opt.UnhealthyThreshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	nbFailures := h.addRetriableFailure(host)
+	if nbFailures >= threshold {
+		return fmt.Errorf("%w, retriable failure %d/%d", err, nbFailures, threshold)
+	}
+	return &WarnError{
+		Err: fmt.Errorf("%w, retriable failure %d/%d", err, nbFailures, threshold),
+	}
+}
+
+func (h *HttpHealthCheck) resetRetriableFailures(host string) {
+	h.retriableMu.Lock()
+	defer h.retriableMu.Unlock()
+	delete(h.retriableFailures, host)
+}
+
+// addRetriableFailure gives number of consecutive retriable failures of host with this one,
+// failures of hosts not checked since retriableFailuresExpiry are forgotten.
+func (h *HttpHealthCheck) addRetriableFailure(host string) uint32 {
+	h.retriableMu.Lock()
+	defer h.retriableMu.Unlock()
+	now := time.Now()
+	if now.Sub(h.retriableSweep) > retriableFailuresExpiry {
+		h.retriableSweep = now
+		for failuresHost, failures := range h.retriableFailures {
+			if now.Sub(failures.last) > retriableFailuresExpiry {
+				delete(h.retriableFailures, failuresHost)
+			}
+		}
+	}
+	failures, ok := h.retriableFailures[host]
+	if !ok || now.Sub(failures.last) > retriableFailuresExpiry {
+		failures = &retriableFailures{}
+		h.retriableFailures[host] = failures
+	}
+	failures.count++
+	failures.last = now
+	return failures.count
+}
+
+// unixUrlHostSuffix suffix of url hosts encoding a unix socket path, encoding the path in url host
+// keeps connections pools separated by socket in transports.
+const unixUrlHostSuffix = ".unix.gohc"
+
+func unixUrlHost(host string) string {
+	_, socketPath := dialTarget(host)
+	return hex.EncodeToString([]byte(socketPath)) + unixUrlHostSuffix
+}
+
+func dialUnixUrlHost(dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		urlHost, _, err := net.SplitHostPort(addr)
+		if err != nil || !strings.HasSuffix(urlHost, unixUrlHostSuffix) {
+			return dial(ctx, network, addr)
+		}
+		socketPath, err := hex.DecodeString(strings.TrimSuffix(urlHost, unixUrlHostSuffix))
 		if err != nil {
-			return fmt.Errorf("failed to read response body: %v", err)
+			return nil, fmt.Errorf("invalid unix socket host %s: %w", urlHost, err)
 		}
-		if !bytes.Contains(b, h.opt.Receive.GetData()) {
-			return fmt.Errorf("response body does not contains expected data")
+		return dial(ctx, "unix", string(socketPath))
+	}
+}
+
+// unixRoundTripper sends requests to unix socket hosts with its own transport
+type unixRoundTripper struct {
+	http.RoundTripper
+	unix *http.Transport
+}
+
+func (t *unixRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Hostname(), unixUrlHostSuffix) {
+		return t.unix.RoundTrip(req)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func (t *unixRoundTripper) CloseIdleConnections() {
+	if closer, ok := t.RoundTripper.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+	t.unix.CloseIdleConnections()
+}
+
+// connTracker keeps track of connections creation time to close idle connections older than max age
+// before they can be reused, connections in use by a running check are never closed.
+type connTracker struct {
+	maxAge time.Duration
+	mu     sync.Mutex
+	conns  map[*trackedConn]struct{}
+}
+
+func newConnTracker(maxAge time.Duration) *connTracker {
+	return &connTracker{
+		maxAge: maxAge,
+		conns:  make(map[*trackedConn]struct{}),
+	}
+}
+
+func (t *connTracker) wrapDial(dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
 		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		tracked := &trackedConn{Conn: conn, tracker: t, created: time.Now()}
+		t.conns[tracked] = struct{}{}
+		return tracked, nil
 	}
-	return nil
 }
 
-func makeHttpClient(codec CodecClientType, tlsConf *tls.Config, timeout time.Duration) *http.Client {
-	dialer := &net.Dialer{
-		Timeout:   30 * time.Second,
-		KeepAlive: 30 * time.Second,
+// acquire marks connection given by transport as in use until returned release function is called
+func (t *connTracker) acquire(conn net.Conn) func() {
+	// tls connections wrap connection we dialed
+	if netConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = netConn.NetConn()
+	}
+	tracked, ok := conn.(*trackedConn)
+	if !ok {
+		return func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked.inUse++
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		tracked.inUse--
+	}
+}
+
+// closeExpired closes idle connections older than max age
+func (t *connTracker) closeExpired() {
+	t.mu.Lock()
+	var expired []net.Conn
+	for conn := range t.conns {
+		if conn.inUse == 0 && time.Since(conn.created) > t.maxAge {
+			expired = append(expired, conn)
+		}
+	}
+	t.mu.Unlock()
+	for _, conn := range expired {
+		conn.Close()
+	}
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	created time.Time
+	// number of checks using connection, guarded by tracker mutex
+	inUse int
+}
+
+func (c *trackedConn) Close() error {
+	c.tracker.mu.Lock()
+	delete(c.tracker.conns, c)
+	c.tracker.mu.Unlock()
+	return c.Conn.Close()
+}
+
+type dialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func makeHttpClient(opt *HttpOpt, dial dialContextFunc) *http.Client {
+	timeout := opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
 	}
 	var roundTripper http.RoundTripper
-	switch codec {
-	case CodecClientType_HTTP3:
+	switch {
+	case opt.CodecClientType == CodecClientType_HTTP3:
+		quicDial := makeQuicDial(opt.Network)
+		if opt.Resolver != nil {
+			quicDial = wrapQuicDialResolver(newResolver(opt.Resolver), quicDial)
+		}
 		roundTripper = &http3.RoundTripper{
-			TLSClientConfig: tlsConf,
+			TLSClientConfig: opt.TlsConfig,
+			QuicConfig: &quic.Config{
+				HandshakeIdleTimeout: timeout,
+			},
+			Dial: quicDial,
+		}
+	case opt.CodecClientType == CodecClientType_HTTP2 && !opt.TlsEnabled:
+		// h2c with prior knowledge
+		roundTripper = &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+			ReadIdleTimeout: 30 * time.Second,
 		}
 	default:
-		roundTripper = &http.Transport{
-			Proxy:                 http.ProxyFromEnvironment,
-			DialContext:           dialer.DialContext,
-			ForceAttemptHTTP2:     true,
+		transport := &http.Transport{
+			DialContext:           dial,
+			ForceAttemptHTTP2:     !opt.StrictProtocol || opt.CodecClientType == CodecClientType_HTTP2,
 			MaxIdleConns:          100,
 			IdleConnTimeout:       90 * time.Second,
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
-			TLSClientConfig:       tlsConf,
+			TLSClientConfig:       opt.TlsConfig,
+			DisableKeepAlives:     opt.ConnectionMode == HttpConnectionNew,
+		}
+		// explicit proxy is handled by dial
+		if opt.Proxy == nil && !opt.DisableEnvProxy {
+			// unlike http.ProxyFromEnvironment, environment is read for each client instead of once per process
+			proxyFunc := httpproxy.FromEnvironment().ProxyFunc()
+			transport.Proxy = func(req *http.Request) (*url.URL, error) {
+				return proxyFunc(req.URL)
+			}
+		}
+		// unix socket hosts are never reached through a proxy
+		unixTransport := transport.Clone()
+		unixTransport.Proxy = nil
+		if opt.TlsEnabled {
+			// url host of unix socket hosts is not a name to verify, server name follows Host header instead
+			serverName := "localhost"
+			if opt.Host != "" && !opt.Templated {
+				serverName = opt.Host
+			}
+			unixTransport.TLSClientConfig = tlsConfigForHost(opt.TlsConfig, serverName)
+		}
+		roundTripper = &unixRoundTripper{
+			RoundTripper: transport,
+			unix:         unixTransport,
 		}
-	}
-	if timeout == 0 {
-		timeout = 5 * time.Second
 	}
 	httpClient := &http.Client{
 		Transport: roundTripper,
@@ -180,6 +789,96 @@ func makeHttpClient(codec CodecClientType, tlsConf *tls.Config, timeout time.Dur
 	return httpClient
 }
 
+type quicDialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error)
+
+// makeQuicDial gives a quic dial function, udp socket is created with network options if set
+func makeQuicDial(network *NetworkOpt) quicDialFunc {
+	if network == nil {
+		return dialQuicWithoutEarlyData
+	}
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		localAddr := ":0"
+		if network.LocalAddr != "" {
+			localAddr = net.JoinHostPort(network.LocalAddr, "0")
+		}
+		listenConfig := &net.ListenConfig{
+			Control: network.control,
+		}
+		packetConn, err := listenConfig.ListenPacket(ctx, "udp", localAddr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := quic.DialEarly(ctx, packetConn, udpAddr, tlsCfg, cfg)
+		if err == nil {
+			conn, err = waitQuicHandshake(ctx, conn)
+		}
+		if err != nil {
+			packetConn.Close()
+			return nil, err
+		}
+		// quic does not close packet conn given by caller
+		go func() {
+			<-conn.Context().Done()
+			packetConn.Close()
+		}()
+		return conn, nil
+	}
+}
+
+// wrapQuicDialResolver gives a quic dial function resolving host with resolver and trying its addresses in order
+func wrapQuicDialResolver(r *resolver, dial quicDialFunc) quicDialFunc {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, addr, tlsCfg, cfg)
+		}
+		ips, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, net.JoinHostPort(ip.String(), port), tlsCfg, cfg)
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	}
+}
+
+// dialQuicWithoutEarlyData waits for handshake completion before giving connection to disable 0-RTT
+func dialQuicWithoutEarlyData(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	conn, err := quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return waitQuicHandshake(ctx, conn)
+}
+
+func waitQuicHandshake(ctx context.Context, conn quic.EarlyConnection) (quic.EarlyConnection, error) {
+	select {
+	case <-conn.HandshakeComplete():
+		return conn, nil
+	case <-ctx.Done():
+		conn.CloseWithError(0, "")
+		return nil, ctx.Err()
+	}
+}
+
+func (h *HttpHealthCheck) pinIp(hostname string, ip net.IP) HealthChecker {
+	opt := *h.opt
+	opt.Resolver = pinResolver(opt.Resolver, hostname, ip)
+	return NewHttpHealthCheck(&opt)
+}
+
 func (h *HttpHealthCheck) String() string {
 	return "HttpHealthCheck"
 }
@@ -0,0 +1,233 @@
+package gohc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type HttpAssertionType int32
+
+const (
+	// HttpAssertionBody asserts on response body, body must contain Value (or match it if Regex is set)
+	HttpAssertionBody HttpAssertionType = 0
+	// HttpAssertionHeader asserts on response header named by Target, header must be present and, if Value is set,
+	// one of its values must be equal to Value (or match it if Regex is set)
+	HttpAssertionHeader HttpAssertionType = 1
+	// HttpAssertionJsonPath asserts on value found in json response body at path Target (e.g.: $.db.status),
+	// value must be equal to Value (or match it if Regex is set). Strings are compared without quotes, other
+	// values are compared in their json form. If Value is empty it only asserts that path exists.
+	HttpAssertionJsonPath HttpAssertionType = 2
+)
+
+// HttpAssertion Describes an assertion made on the http response.
+type HttpAssertion struct {
+	// Type of assertion
+	Type HttpAssertionType
+	// Target header name for HttpAssertionHeader or json path for HttpAssertionJsonPath
+	Target string
+	// Value expected
+	Value string
+	// Regex set to true to use Value as a regular expression
+	Regex bool
+	// Not set to true to negate the assertion (e.g.: body must not contain "ERROR", header must not be present)
+	Not bool
+}
+
+func (a *HttpAssertion) String() string {
+	must := "must"
+	if a.Not {
+		must = "must not"
+	}
+	verb := "contain"
+	if a.Type != HttpAssertionBody {
+		verb = "be"
+	}
+	if a.Regex {
+		verb = "match"
+	}
+	switch a.Type {
+	case HttpAssertionHeader:
+		if a.Value == "" {
+			return fmt.Sprintf("header '%s' %s be present", a.Target, must)
+		}
+		return fmt.Sprintf("header '%s' %s %s '%s'", a.Target, must, verb, a.Value)
+	case HttpAssertionJsonPath:
+		if a.Value == "" {
+			return fmt.Sprintf("json path '%s' %s exist", a.Target, must)
+		}
+		return fmt.Sprintf("json path '%s' %s %s '%s'", a.Target, must, verb, a.Value)
+	}
+	return fmt.Sprintf("body %s %s '%s'", must, verb, a.Value)
+}
+
+type httpAssertionMatcher struct {
+	assertion *HttpAssertion
+	regex     *regexp.Regexp
+	path      []any
+}
+
+func makeHttpAssertionMatchers(assertions []*HttpAssertion) ([]*httpAssertionMatcher, error) {
+	matchers := make([]*httpAssertionMatcher, len(assertions))
+	for i, assertion := range assertions {
+		matcher := &httpAssertionMatcher{
+			assertion: assertion,
+		}
+		var err error
+		if assertion.Regex {
+			matcher.regex, err = regexp.Compile(assertion.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex for assertion %s: %w", assertion, err)
+			}
+		}
+		if assertion.Type == HttpAssertionJsonPath {
+			matcher.path, err = parseJsonPath(assertion.Target)
+			if err != nil {
+				return nil, fmt.Errorf("invalid json path for assertion %s: %w", assertion, err)
+			}
+		}
+		matchers[i] = matcher
+	}
+	return matchers, nil
+}
+
+func (m *httpAssertionMatcher) needBody() bool {
+	return m.assertion.Type != HttpAssertionHeader
+}
+
+// match returns if assertion passed and a description of what was found to explain a failure
+func (m *httpAssertionMatcher) match(header http.Header, body []byte) (bool, string) {
+	ok, got := m.matchPositive(header, body)
+	if m.assertion.Not {
+		return !ok, got
+	}
+	return ok, got
+}
+
+func (m *httpAssertionMatcher) matchPositive(header http.Header, body []byte) (bool, string) {
+	switch m.assertion.Type {
+	case HttpAssertionHeader:
+		values := header.Values(m.assertion.Target)
+		if len(values) == 0 {
+			return false, "header not present"
+		}
+		if m.assertion.Value == "" {
+			return true, "header present"
+		}
+		for _, value := range values {
+			if m.matchValue(value) {
+				return true, fmt.Sprintf("got '%s'", value)
+			}
+		}
+		return false, fmt.Sprintf("got '%s'", strings.Join(values, ", "))
+	case HttpAssertionJsonPath:
+		var data any
+		if err := json.Unmarshal(body, &data); err != nil {
+			return false, fmt.Sprintf("body is not valid json: %s", err)
+		}
+		value, found := lookupJsonPath(data, m.path)
+		if !found {
+			return false, "path not found"
+		}
+		valueStr, ok := value.(string)
+		if !ok {
+			b, _ := json.Marshal(value)
+			valueStr = string(b)
+		}
+		if m.assertion.Value == "" {
+			return true, fmt.Sprintf("got '%s'", valueStr)
+		}
+		return m.matchValue(valueStr), fmt.Sprintf("got '%s'", valueStr)
+	}
+	found := bytes.Contains(body, []byte(m.assertion.Value))
+	if m.regex != nil {
+		found = m.regex.Match(body)
+	}
+	if found {
+		return true, "found in body"
+	}
+	return false, "not found in body"
+}
+
+func (m *httpAssertionMatcher) matchValue(value string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+	return value == m.assertion.Value
+}
+
+// parseJsonPath parses a subset of json path: dotted keys and brackets with index or quoted key
+// (e.g.: $.db.status, $.items[0].name, $['my key']). It gives a list of keys (string) and indexes (int).
+func parseJsonPath(path string) ([]any, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var elems []any
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key")
+			}
+			elems = append(elems, path[:end])
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("missing closing bracket")
+			}
+			inside := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			if len(inside) >= 2 && (inside[0] == '\'' || inside[0] == '"') && inside[len(inside)-1] == inside[0] {
+				elems = append(elems, inside[1:len(inside)-1])
+				continue
+			}
+			index, err := strconv.Atoi(inside)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index '%s'", inside)
+			}
+			elems = append(elems, index)
+		default:
+			// path without leading $. (e.g.: db.status)
+			path = "." + path
+		}
+	}
+	return elems, nil
+}
+
+func lookupJsonPath(data any, path []any) (any, bool) {
+	current := data
+	for _, elem := range path {
+		switch key := elem.(type) {
+		case string:
+			obj, ok := current.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			current, ok = obj[key]
+			if !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := current.([]any)
+			if !ok {
+				return nil, false
+			}
+			if key < 0 {
+				key = len(list) + key
+			}
+			if key < 0 || key >= len(list) {
+				return nil, false
+			}
+			current = list[key]
+		}
+	}
+	return current, true
+}
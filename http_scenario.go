@@ -0,0 +1,377 @@
+package gohc
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"time"
+)
+
+type HttpExtractorType int32
+
+const (
+	// HttpExtractorJsonPath captures value found in json response body at path Target (e.g.: $.token)
+	HttpExtractorJsonPath HttpExtractorType = 0
+	// HttpExtractorHeader captures first value of response header named by Target
+	HttpExtractorHeader HttpExtractorType = 1
+	// HttpExtractorRegex captures first match of regular expression Target in response body,
+	// first capture group is used if the regex has one
+	HttpExtractorRegex HttpExtractorType = 2
+)
+
+// HttpExtractor Describes a value to capture from a step response, captured value can be used in later steps
+// with {{.Captures.<Name>}}.
+type HttpExtractor struct {
+	// Name of the captured value
+	Name string
+	// Type of extractor
+	Type HttpExtractorType
+	// Target json path for HttpExtractorJsonPath, header name for HttpExtractorHeader
+	// or regular expression for HttpExtractorRegex
+	Target string
+}
+
+func (e *HttpExtractor) String() string {
+	switch e.Type {
+	case HttpExtractorHeader:
+		return fmt.Sprintf("extractor '%s' on header '%s'", e.Name, e.Target)
+	case HttpExtractorRegex:
+		return fmt.Sprintf("extractor '%s' on body regex '%s'", e.Name, e.Target)
+	}
+	return fmt.Sprintf("extractor '%s' on json path '%s'", e.Name, e.Target)
+}
+
+// HttpScenarioStep Describes a request made in a scenario and how to check its response.
+// Path, Headers values, Send and Receive text payloads are go templates rendered with TemplateVars,
+// values captured by previous steps are available in {{.Captures.<name>}}.
+type HttpScenarioStep struct {
+	// Name of the step used in results and errors. If left empty (default to "step <index starting at 1>")
+	Name string
+	// Method of the request. If left empty (default to GET)
+	Method string
+	// Path requested (e.g.: /api/me?session={{.Captures.session}}).
+	Path string
+	// Headers to add to the request
+	Headers http.Header
+	// Send payload sent as request body
+	Send *Payload
+	// ExpectedStatuses ranges of accepted statuses. If left empty (default to [200, 201))
+	ExpectedStatuses []*IntRange
+	// Receive payload which must be found in response body
+	Receive *Payload
+	// Assertions to make on response
+	Assertions []*HttpAssertion
+	// Extractors capture values from response for later steps
+	Extractors []*HttpExtractor
+}
+
+// HttpScenarioOpt Describes a scenario of ordered http requests, steps share a cookie jar and connections.
+type HttpScenarioOpt struct {
+	// Steps of the scenario, run in order, scenario stops at first failing step
+	Steps []*HttpScenarioStep
+	// The value of the host header in each request
+	Host string
+	// Timeout for each step. If left empty (default to 5s)
+	Timeout time.Duration
+	// TlsEnabled set to true if requests should be sent over TLS.
+	TlsEnabled bool
+	// TlsConfig specifies the TLS configuration to use for TLS enabled requests.
+	TlsConfig *tls.Config
+	// AltPort specifies the port to use for requests.
+	// If left empty it taks the port from host during check.
+	AltPort uint32
+	// CodecClientType specifies the protocol to use.
+	CodecClientType CodecClientType
+	// MaxBodyBytes max number of bytes read from each response body, assertions and extractors use the truncated body.
+	// If left empty there is no limit. When only Receive is set, body reading stops as soon as payload is found.
+	MaxBodyBytes int64
+	// Auth if set, gives credentials headers added to each request.
+	Auth AuthProvider
+	// Signer if set, signs each request just before it is sent.
+	Signer RequestSigner
+	// Proxy if set, connections are made through this proxy.
+	Proxy *ProxyOpt
+	// DisableEnvProxy set to true to not use proxy set in environment variables (HTTP_PROXY, HTTPS_PROXY, NO_PROXY).
+	// Environment variables are read when the health check is created, unix socket hosts are never proxied.
+	DisableEnvProxy bool
+	// Network if set, describes source address, interface and socket options used by connections.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
+	// WarnLatency if set, a successful scenario taking more than this duration returns a WarnError.
+	WarnLatency time.Duration
+}
+
+// HttpStepResult gives details on a scenario step.
+type HttpStepResult struct {
+	// Name of the step
+	Name string
+	// StatusCode of the response, 0 if no response was received
+	StatusCode int
+	// Duration of the step
+	Duration time.Duration
+	// Err is the error of the step, nil if it passed
+	Err error
+}
+
+// HttpScenarioResult gives details on a scenario check.
+type HttpScenarioResult struct {
+	// Steps results of steps which have been run
+	Steps []*HttpStepResult
+	// Captures values captured during scenario
+	Captures map[string]string
+	// Duration of the scenario
+	Duration time.Duration
+}
+
+type httpScenarioStep struct {
+	step       *HttpScenarioStep
+	name       string
+	assertions []*httpAssertionMatcher
+	regexes    map[string]*regexp.Regexp
+	jsonPaths  map[string][]any
+	// needBody true if an extractor needs the whole response body
+	needBody bool
+}
+
+type HttpScenarioHealthCheck struct {
+	opt *HttpScenarioOpt
+	// httpOpt options shared by steps to make client and requests as http health check does
+	httpOpt    *HttpOpt
+	httpClient *http.Client
+	steps      []*httpScenarioStep
+	optErr     error
+}
+
+func NewHttpScenarioHealthCheck(opt *HttpScenarioOpt) *HttpScenarioHealthCheck {
+	hc := &HttpScenarioHealthCheck{
+		opt: opt,
+		httpOpt: &HttpOpt{
+			Host:            opt.Host,
+			Timeout:         opt.Timeout,
+			TlsEnabled:      opt.TlsEnabled,
+			TlsConfig:       opt.TlsConfig,
+			CodecClientType: opt.CodecClientType,
+			MaxBodyBytes:    opt.MaxBodyBytes,
+			Auth:            opt.Auth,
+			Signer:          opt.Signer,
+			Proxy:           opt.Proxy,
+			DisableEnvProxy: opt.DisableEnvProxy,
+			Network:         opt.Network,
+			Resolver:        opt.Resolver,
+		},
+	}
+	hc.steps, hc.optErr = makeHttpScenarioSteps(opt.Steps)
+	if hc.optErr == nil {
+		hc.optErr = validateHttpOpt(hc.httpOpt)
+	}
+	dial, err := makeHttpDial(hc.httpOpt)
+	if err != nil && hc.optErr == nil {
+		hc.optErr = err
+	}
+	hc.httpClient = makeHttpClient(hc.httpOpt, dial)
+	return hc
+}
+
+func makeHttpScenarioSteps(steps []*HttpScenarioStep) ([]*httpScenarioStep, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("scenario must have at least one step")
+	}
+	scenarioSteps := make([]*httpScenarioStep, len(steps))
+	for i, step := range steps {
+		scenarioStep := &httpScenarioStep{
+			step:      step,
+			name:      step.Name,
+			regexes:   make(map[string]*regexp.Regexp),
+			jsonPaths: make(map[string][]any),
+		}
+		if scenarioStep.name == "" {
+			scenarioStep.name = fmt.Sprintf("step %d", i+1)
+		}
+		var err error
+		scenarioStep.assertions, err = makeHttpAssertionMatchers(step.Assertions)
+		if err != nil {
+			return nil, fmt.Errorf("step '%s': %w", scenarioStep.name, err)
+		}
+		for _, extractor := range step.Extractors {
+			switch extractor.Type {
+			case HttpExtractorRegex:
+				scenarioStep.regexes[extractor.Name], err = regexp.Compile(extractor.Target)
+				scenarioStep.needBody = true
+			case HttpExtractorJsonPath:
+				scenarioStep.jsonPaths[extractor.Name], err = parseJsonPath(extractor.Target)
+				scenarioStep.needBody = true
+			}
+			if err != nil {
+				return nil, fmt.Errorf("step '%s': invalid %s: %w", scenarioStep.name, extractor, err)
+			}
+		}
+		scenarioSteps[i] = scenarioStep
+	}
+	return scenarioSteps, nil
+}
+
+func (h *HttpScenarioHealthCheck) Check(host string) error {
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// Close closes idle connections kept for reuse between scenarios.
+func (h *HttpScenarioHealthCheck) Close() {
+	h.httpClient.CloseIdleConnections()
+}
+
+// CheckWithResult runs the scenario as Check does and gives details on each step run.
+func (h *HttpScenarioHealthCheck) CheckWithResult(host string) (*HttpScenarioResult, error) {
+	start := time.Now()
+	result := &HttpScenarioResult{
+		Captures: make(map[string]string),
+	}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	return result, checkLatency(start, h.opt.WarnLatency)
+}
+
+func (h *HttpScenarioHealthCheck) check(host string, result *HttpScenarioResult) error {
+	if h.optErr != nil {
+		return h.optErr
+	}
+	host, err := FormatHost(host, h.opt.AltPort)
+	if err != nil {
+		return err
+	}
+	vars, err := newTemplateVars(host)
+	if err != nil {
+		return err
+	}
+	vars.Captures = result.Captures
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	// each check has its own cookies but shares connections with other checks
+	client := *h.httpClient
+	client.Jar = jar
+
+	for _, step := range h.steps {
+		stepStart := time.Now()
+		stepResult := &HttpStepResult{
+			Name: step.name,
+		}
+		result.Steps = append(result.Steps, stepResult)
+		stepResult.Err = h.runStep(&client, host, step, vars, stepResult)
+		stepResult.Duration = time.Since(stepStart)
+		if stepResult.Err != nil {
+			return fmt.Errorf("step '%s' failed: %w", step.name, stepResult.Err)
+		}
+	}
+	return nil
+}
+
+func (h *HttpScenarioHealthCheck) runStep(client *http.Client, host string, step *httpScenarioStep, vars *TemplateVars, stepResult *HttpStepResult) error {
+	parts := &httpRequestParts{
+		method: step.step.Method,
+		host:   h.opt.Host,
+	}
+	var err error
+	parts.path, err = vars.render(step.step.Path)
+	if err != nil {
+		return err
+	}
+	parts.headers, err = vars.renderHeader(step.step.Headers)
+	if err != nil {
+		return err
+	}
+	parts.send, err = vars.renderPayload(step.step.Send)
+	if err != nil {
+		return err
+	}
+	parts.receive, err = vars.renderPayload(step.step.Receive)
+	if err != nil {
+		return err
+	}
+	req, err := newHttpRequest(h.httpOpt, host, parts)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	stepResult.StatusCode = resp.StatusCode
+
+	expectedStatuses := step.step.ExpectedStatuses
+	if len(expectedStatuses) == 0 {
+		expectedStatuses = []*IntRange{{Start: 200, End: 201}}
+	}
+	err = checkHttpStatus(expectedStatuses, int64(resp.StatusCode))
+	if err != nil {
+		return err
+	}
+	b, err := checkHttpBody(resp, parts.receive, step.assertions, h.opt.MaxBodyBytes, step.needBody)
+	if err != nil {
+		return err
+	}
+	for _, extractor := range step.step.Extractors {
+		value, err := step.extract(extractor, resp.Header, b)
+		if err != nil {
+			return err
+		}
+		vars.Captures[extractor.Name] = value
+	}
+	return nil
+}
+
+func (s *httpScenarioStep) extract(extractor *HttpExtractor, header http.Header, body []byte) (string, error) {
+	switch extractor.Type {
+	case HttpExtractorHeader:
+		value := header.Get(extractor.Target)
+		if value == "" {
+			return "", fmt.Errorf("%s: header not present", extractor)
+		}
+		return value, nil
+	case HttpExtractorRegex:
+		match := s.regexes[extractor.Name].FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("%s: no match in body", extractor)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	}
+	var data any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", fmt.Errorf("%s: body is not valid json: %s", extractor, err)
+	}
+	value, found := lookupJsonPath(data, s.jsonPaths[extractor.Name])
+	if !found {
+		return "", fmt.Errorf("%s: path not found", extractor)
+	}
+	valueStr, ok := value.(string)
+	if !ok {
+		b, _ := json.Marshal(value)
+		valueStr = string(b)
+	}
+	return valueStr, nil
+}
+
+func (h *HttpScenarioHealthCheck) pinIp(hostname string, ip net.IP) HealthChecker {
+	opt := *h.opt
+	opt.Resolver = pinResolver(opt.Resolver, hostname, ip)
+	return NewHttpScenarioHealthCheck(&opt)
+}
+
+func (h *HttpScenarioHealthCheck) String() string {
+	return fmt.Sprintf("HttpScenarioHealthCheck, %d steps", len(h.opt.Steps))
+}
@@ -0,0 +1,141 @@
+package gohc_test
+
+import (
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"net/http"
+)
+
+var _ = Describe("HttpScenario", func() {
+	var server *ghttp.Server
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		server.RouteToHandler("POST", "/login", func(w http.ResponseWriter, req *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t", Path: "/"})
+			w.Header().Set("X-Csrf", "csrf-token")
+			w.Write([]byte(`{"token": "abc", "user": {"id": 42}}`))
+		})
+		server.RouteToHandler("GET", "/api/me", func(w http.ResponseWriter, req *http.Request) {
+			cookie, err := req.Cookie("session")
+			if err != nil || cookie.Value != "s3cr3t" || req.Header.Get("Authorization") != "Bearer abc" ||
+				req.URL.Query().Get("id") != "42" || req.Header.Get("X-Csrf") != "csrf-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"name": "bob", "session": "sess-42-end"}`))
+		})
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	loginStep := func() *HttpScenarioStep {
+		return &HttpScenarioStep{
+			Name:   "login",
+			Method: "POST",
+			Path:   "/login",
+			Send:   &Payload{Text: `{"user": "bob"}`},
+			Extractors: []*HttpExtractor{
+				{Name: "token", Type: HttpExtractorJsonPath, Target: "$.token"},
+				{Name: "id", Type: HttpExtractorJsonPath, Target: "$.user.id"},
+				{Name: "csrf", Type: HttpExtractorHeader, Target: "X-Csrf"},
+			},
+		}
+	}
+	It("should run steps in order sharing cookies and captured values", func() {
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{
+			Steps: []*HttpScenarioStep{
+				loginStep(),
+				{
+					Name: "me",
+					Path: "/api/me?id={{.Captures.id}}",
+					Headers: http.Header{
+						"Authorization": []string{"Bearer {{.Captures.token}}"},
+						"X-Csrf":        []string{"{{.Captures.csrf}}"},
+					},
+					Assertions: []*HttpAssertion{
+						{Type: HttpAssertionJsonPath, Target: "$.name", Value: "bob"},
+					},
+					Extractors: []*HttpExtractor{
+						{Name: "session", Type: HttpExtractorRegex, Target: `sess-(\d+)-end`},
+					},
+				},
+			},
+		})
+
+		result, err := hc.CheckWithResult(urlToHost(server.URL()))
+		Expect(err).To(BeNil())
+		Expect(result.Steps).To(HaveLen(2))
+		Expect(result.Steps[0].Name).To(Equal("login"))
+		Expect(result.Steps[1].StatusCode).To(Equal(200))
+		Expect(result.Steps[1].Duration).To(BeNumerically(">", 0))
+		Expect(result.Captures).To(HaveKeyWithValue("session", "42"))
+	})
+	It("should name failing step in error and stop scenario", func() {
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{
+			Steps: []*HttpScenarioStep{
+				{Path: "/api/me"},
+				loginStep(),
+			},
+		})
+
+		result, err := hc.CheckWithResult(urlToHost(server.URL()))
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("step 'step 1' failed"))
+		Expect(err.Error()).To(ContainSubstring("401"))
+		Expect(result.Steps).To(HaveLen(1))
+		Expect(result.Steps[0].Err).ToNot(BeNil())
+	})
+	It("should read response body up to max body bytes", func() {
+		step := loginStep()
+		step.Receive = &Payload{Text: `"id": 42`}
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{
+			Steps:        []*HttpScenarioStep{step},
+			MaxBodyBytes: 20,
+		})
+
+		err := hc.Check(urlToHost(server.URL()))
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("response body does not contains expected data"))
+	})
+	It("should fail when extractor finds nothing", func() {
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{
+			Steps: []*HttpScenarioStep{
+				{
+					Name:   "login",
+					Method: "POST",
+					Path:   "/login",
+					Extractors: []*HttpExtractor{
+						{Name: "missing", Type: HttpExtractorJsonPath, Target: "$.missing"},
+					},
+				},
+			},
+		})
+
+		err := hc.Check(urlToHost(server.URL()))
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("step 'login' failed: extractor 'missing' on json path '$.missing': path not found"))
+	})
+	It("should not share cookies between checks", func() {
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{
+			Steps: []*HttpScenarioStep{
+				{
+					Path:             "/api/me",
+					ExpectedStatuses: []*IntRange{{Start: 401, End: 402}},
+				},
+				loginStep(),
+			},
+		})
+
+		Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+		Expect(hc.Check(urlToHost(server.URL()))).To(Succeed())
+	})
+	It("should return an error when scenario has no steps", func() {
+		hc := NewHttpScenarioHealthCheck(&HttpScenarioOpt{})
+
+		err := hc.Check(urlToHost(server.URL()))
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("at least one step"))
+	})
+})
@@ -2,13 +2,19 @@ package gohc_test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"io"
 	"net"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"time"
 )
@@ -54,6 +60,19 @@ var _ = Describe("Http", func() {
 				Expect(err).ToNot(BeNil())
 				Expect(err.Error()).To(ContainSubstring("context deadline exceeded"))
 			})
+			It("should return a warning when check is slower than warn latency", func() {
+				server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+					time.Sleep(10 * time.Millisecond)
+				})
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					WarnLatency: 1 * time.Millisecond,
+				})
+
+				err := hc.Check(urlToHost(server.URL()))
+				Expect(err).ToNot(BeNil())
+				Expect(StatusFromError(err)).To(Equal(HealthStatusWarn))
+			})
 			It("should return nil when status code is in expected range", func() {
 				server.AppendHandlers(ghttp.RespondWith(404, "NOT FOUND"))
 
@@ -67,6 +86,88 @@ var _ = Describe("Http", func() {
 				err := hc.Check(urlToHost(server.URL()))
 				Expect(err).To(BeNil())
 			})
+			It("should return nil when status code is in one of expected ranges", func() {
+				server.AppendHandlers(ghttp.RespondWith(401, "UNAUTHORIZED"), ghttp.RespondWith(302, "FOUND"))
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					ExpectedStatusRanges: []*IntRange{
+						{Start: 200, End: 300},
+						{Start: 401, End: 402},
+					},
+				})
+
+				err := hc.Check(urlToHost(server.URL()))
+				Expect(err).To(BeNil())
+
+				err = hc.Check(urlToHost(server.URL()))
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("[200, 300), [401, 402)"))
+			})
+			It("should return a warning on retriable status until unhealthy threshold is reached", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(503, "UNAVAILABLE"),
+					ghttp.RespondWith(503, "UNAVAILABLE"),
+					ghttp.RespondWith(200, "OK"),
+					ghttp.RespondWith(503, "UNAVAILABLE"),
+					ghttp.RespondWith(500, "ERROR"),
+				)
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					RetriableStatuses: []*IntRange{
+						{Start: 503, End: 504},
+					},
+					UnhealthyThreshold: 2,
+				})
+				host := urlToHost(server.URL())
+
+				err := hc.Check(host)
+				Expect(IsWarning(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("retriable failure 1/2"))
+
+				err = hc.Check(host)
+				Expect(err).ToNot(BeNil())
+				Expect(IsWarning(err)).To(BeFalse())
+
+				Expect(hc.Check(host)).To(BeNil())
+
+				err = hc.Check(host)
+				Expect(IsWarning(err)).To(BeTrue())
+
+				err = hc.Check(host)
+				Expect(err).ToNot(BeNil())
+				Expect(IsWarning(err)).To(BeFalse())
+			})
+			It("should reset retriable failures when request failed", func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(503, "UNAVAILABLE"),
+					func(w http.ResponseWriter, req *http.Request) {
+						conn, _, err := w.(http.Hijacker).Hijack()
+						Expect(err).To(BeNil())
+						conn.Close()
+					},
+					ghttp.RespondWith(503, "UNAVAILABLE"),
+				)
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					RetriableStatuses: []*IntRange{
+						{Start: 503, End: 504},
+					},
+					UnhealthyThreshold: 2,
+					ConnectionMode:     HttpConnectionNew,
+				})
+				host := urlToHost(server.URL())
+
+				err := hc.Check(host)
+				Expect(IsWarning(err)).To(BeTrue())
+
+				err = hc.Check(host)
+				Expect(err).ToNot(BeNil())
+				Expect(IsWarning(err)).To(BeFalse())
+
+				err = hc.Check(host)
+				Expect(IsWarning(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("retriable failure 1/2"))
+			})
 			It("should append headers when user declare it", func() {
 				server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
 					Expect(req.Header.Get("X-Test")).To(Equal("test"))
@@ -110,6 +211,46 @@ var _ = Describe("Http", func() {
 				Expect(err).To(BeNil())
 				Expect(server.ReceivedRequests()).Should(HaveLen(1))
 			})
+			It("should render templates and expect nonce echoed when templated", func() {
+				server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+					Expect(req.Header.Get("X-Target")).To(Equal("127.0.0.1"))
+					Expect(req.URL.Query().Get("ts")).To(MatchRegexp(`^\d+$`))
+					w.Write([]byte("nonce=" + req.URL.Query().Get("nonce")))
+				})
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					Path:      "/health?nonce={{.Nonce}}&ts={{.Timestamp}}",
+					Headers:   http.Header{"X-Target": []string{"{{.Host}}"}},
+					Receive:   &Payload{Text: "nonce={{.Nonce}}"},
+					Templated: true,
+				})
+
+				err := hc.Check(urlToHost(server.URL()))
+				Expect(err).To(BeNil())
+			})
+			It("should fail when cached response does not contain nonce", func() {
+				server.AppendHandlers(ghttp.RespondWith(200, "nonce=0000000000000000"))
+
+				hc := NewHttpHealthCheck(&HttpOpt{
+					Path:      "/health?nonce={{.Nonce}}",
+					Receive:   &Payload{Text: "nonce={{.Nonce}}"},
+					Templated: true,
+				})
+
+				err := hc.Check(urlToHost(server.URL()))
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("does not contains expected data"))
+			})
+			It("should return an error when template is invalid", func() {
+				hc := NewHttpHealthCheck(&HttpOpt{
+					Path:      "/health?nonce={{.Unknown}}",
+					Templated: true,
+				})
+
+				err := hc.Check(urlToHost(server.URL()))
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("fail to render template"))
+			})
 			It("should use alt port when given", func() {
 				server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
 					Expect(req.Host).To(Equal("myhost"))
@@ -174,6 +315,436 @@ var _ = Describe("Http", func() {
 					Expect(server.ReceivedRequests()).Should(HaveLen(1))
 				})
 			})
+			When("User set connection mode", func() {
+				BeforeEach(func() {
+					server.RouteToHandler("GET", "/", ghttp.RespondWith(200, "OK"))
+				})
+				It("should reuse connection by default", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{})
+
+					result, err := hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(result.ConnReused).To(BeFalse())
+					Expect(result.StatusCode).To(Equal(200))
+
+					result, err = hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(result.ConnReused).To(BeTrue())
+				})
+				It("should always use new connection when mode is new", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						ConnectionMode: HttpConnectionNew,
+					})
+
+					_, err := hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+
+					result, err := hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(result.ConnReused).To(BeFalse())
+				})
+				It("should not reuse connection older than max age", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						ConnectionMode:   HttpConnectionReuseMaxAge,
+						ConnectionMaxAge: 100 * time.Millisecond,
+					})
+
+					_, err := hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+
+					result, err := hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(result.ConnReused).To(BeTrue())
+
+					time.Sleep(150 * time.Millisecond)
+					result, err = hc.CheckWithResult(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(result.ConnReused).To(BeFalse())
+				})
+				It("should not close connection older than max age in use by a concurrent check", func() {
+					server.RouteToHandler("GET", "/slow", func(w http.ResponseWriter, req *http.Request) {
+						time.Sleep(300 * time.Millisecond)
+						w.WriteHeader(200)
+					})
+					slowHc := NewHttpHealthCheck(&HttpOpt{
+						Path:             "/slow",
+						ConnectionMode:   HttpConnectionReuseMaxAge,
+						ConnectionMaxAge: 50 * time.Millisecond,
+					})
+					slowErr := make(chan error, 1)
+					go func() {
+						defer GinkgoRecover()
+						slowErr <- slowHc.Check(urlToHost(server.URL()))
+					}()
+
+					// slow check connection is expired while its request runs
+					time.Sleep(150 * time.Millisecond)
+					err := slowHc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(<-slowErr).To(BeNil())
+				})
+			})
+			When("Server redirects", func() {
+				BeforeEach(func() {
+					server.RouteToHandler("GET", "/", ghttp.RespondWith(302, "", http.Header{"Location": {"/redirected"}}))
+					server.RouteToHandler("GET", "/redirected", ghttp.RespondWith(302, "", http.Header{"Location": {"/final"}}))
+					server.RouteToHandler("GET", "/final", ghttp.RespondWith(200, "OK"))
+				})
+				It("should follow redirects by default", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						FinalUrlPattern: "/final$",
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+				})
+				It("should not follow redirects when policy is never", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						RedirectPolicy: HttpRedirectNever,
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("302"))
+				})
+				It("should fail when max redirects is reached", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						MaxRedirects: 1,
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("stopped after 1 redirects"))
+				})
+				It("should fail when final url does not match", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						RedirectPolicy:  HttpRedirectSameHost,
+						FinalUrlPattern: "/other$",
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("does not match"))
+				})
+			})
+			When("User set max body bytes", func() {
+				It("should only read max bytes of body", func() {
+					server.AppendHandlers(ghttp.RespondWith(200, "0123456789 ok"))
+
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Receive:      &Payload{Text: "ok"},
+						MaxBodyBytes: 10,
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("not contains"))
+				})
+				It("should stop reading body when receive payload is found", func() {
+					server.AppendHandlers(func(w http.ResponseWriter, req *http.Request) {
+						w.Write([]byte("status ok"))
+						w.(http.Flusher).Flush()
+						time.Sleep(500 * time.Millisecond)
+					})
+
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Receive: &Payload{Text: "ok"},
+						Timeout: 200 * time.Millisecond,
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+				})
+			})
+			When("User set assertions", func() {
+				BeforeEach(func() {
+					server.AppendHandlers(ghttp.RespondWith(200, `{"status":"UP","db":{"status":"DOWN"},"items":[{"name":"a"}]}`, http.Header{
+						"X-Version": {"1.2.3"},
+					}))
+				})
+				It("should return nil when all assertions pass", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Assertions: []*HttpAssertion{
+							{Type: HttpAssertionBody, Value: `"status":"(UP|OK)"`, Regex: true},
+							{Type: HttpAssertionBody, Value: "ERROR", Not: true},
+							{Type: HttpAssertionJsonPath, Target: "$.status", Value: "UP"},
+							{Type: HttpAssertionJsonPath, Target: "$.items[0].name", Value: "a"},
+							{Type: HttpAssertionHeader, Target: "X-Version", Value: `^1\.`, Regex: true},
+							{Type: HttpAssertionHeader, Target: "X-Forbidden", Not: true},
+						},
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+				})
+				It("should report each failing assertion", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Assertions: []*HttpAssertion{
+							{Type: HttpAssertionJsonPath, Target: "$.db.status", Value: "UP"},
+							{Type: HttpAssertionBody, Value: "DOWN", Not: true},
+							{Type: HttpAssertionHeader, Target: "X-Required"},
+							{Type: HttpAssertionJsonPath, Target: "$.status", Value: "UP"},
+						},
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("json path '$.db.status' must be 'UP': got 'DOWN'"))
+					Expect(err.Error()).To(ContainSubstring("body must not contain 'DOWN'"))
+					Expect(err.Error()).To(ContainSubstring("header 'X-Required' must be present"))
+					Expect(err.Error()).ToNot(ContainSubstring("'$.status'"))
+				})
+				It("should return an error when assertion is invalid", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Assertions: []*HttpAssertion{
+							{Type: HttpAssertionBody, Value: "(", Regex: true},
+						},
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("invalid regex"))
+				})
+			})
+			Context("Proxy", func() {
+				It("should check through http connect proxy with auth and headers", func() {
+					proxyServer, err := testhelpers.NewHttpConnectProxy("user", "pass")
+					Expect(err).To(BeNil())
+					defer proxyServer.Close()
+					server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Proxy: &ProxyOpt{
+							Url:     "http://user:pass@" + proxyServer.Addr(),
+							Headers: http.Header{"X-Proxy": []string{"test"}},
+						},
+					})
+
+					err = hc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(proxyServer.Connections()).To(Equal(int64(1)))
+					Expect(proxyServer.LastHeader().Get("X-Proxy")).To(Equal("test"))
+				})
+				It("should return an error when proxy refuses authentication", func() {
+					proxyServer, err := testhelpers.NewHttpConnectProxy("user", "pass")
+					Expect(err).To(BeNil())
+					defer proxyServer.Close()
+
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Proxy: &ProxyOpt{
+							Url: "http://user:wrong@" + proxyServer.Addr(),
+						},
+					})
+
+					err = hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("407"))
+				})
+				It("should check through socks5 proxy", func() {
+					proxyServer, err := testhelpers.NewSocks5Proxy("user", "pass")
+					Expect(err).To(BeNil())
+					defer proxyServer.Close()
+					server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Proxy: &ProxyOpt{
+							Url: "socks5://user:pass@" + proxyServer.Addr(),
+						},
+					})
+
+					err = hc.Check(urlToHost(server.URL()))
+					Expect(err).To(BeNil())
+					Expect(proxyServer.Connections()).To(Equal(int64(1)))
+				})
+				It("should return an error when proxy scheme is not supported", func() {
+					hc := NewHttpHealthCheck(&HttpOpt{
+						Proxy: &ProxyOpt{
+							Url: "ftp://localhost:21",
+						},
+					})
+
+					err := hc.Check(urlToHost(server.URL()))
+					Expect(err).ToNot(BeNil())
+					Expect(err.Error()).To(ContainSubstring("unsupported proxy scheme"))
+				})
+			})
+		})
+	})
+
+	Context("Unix Socket Server", func() {
+		var server *http.Server
+		var lis net.Listener
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("unix", filepath.Join(GinkgoT().TempDir(), "health.sock"))
+			Expect(err).To(BeNil())
+			server = &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte(req.Host + req.URL.Path))
+				}),
+			}
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should check over unix socket keeping host and path", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Host:    "myhost",
+				Path:    "/health",
+				Receive: &Payload{Text: "myhost/health"},
+			})
+
+			err := hc.Check(UnixHostPrefix + lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should not send requests of unix socket hosts to proxy from environment", func() {
+			GinkgoT().Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Receive: &Payload{Text: "localhost/"},
+			})
+
+			err := hc.Check(UnixHostPrefix + lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should check over unix socket with h2c", func() {
+			server.Handler = h2c.NewHandler(server.Handler, &http2.Server{})
+			hc := NewHttpHealthCheck(&HttpOpt{
+				CodecClientType: CodecClientType_HTTP2,
+				StrictProtocol:  true,
+				Receive:         &Payload{Text: "localhost/"},
+			})
+
+			err := hc.Check(UnixHostPrefix + lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		serveTls := func(serverName string) (net.Listener, *x509.CertPool) {
+			cert, rootCAs, err := testhelpers.NewSelfSignedCert(serverName)
+			Expect(err).To(BeNil())
+			tlsLis, err := net.Listen("unix", filepath.Join(GinkgoT().TempDir(), "tls.sock"))
+			Expect(err).To(BeNil())
+			tlsServer := &http.Server{
+				Handler:   server.Handler,
+				TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+			}
+			DeferCleanup(tlsServer.Close)
+			go tlsServer.ServeTLS(tlsLis, "", "")
+			return tlsLis, rootCAs
+		}
+		It("should verify certificate against localhost over tls on unix socket", func() {
+			tlsLis, rootCAs := serveTls("localhost")
+			hc := NewHttpHealthCheck(&HttpOpt{
+				TlsEnabled: true,
+				TlsConfig: &tls.Config{
+					RootCAs: rootCAs,
+				},
+				Receive: &Payload{Text: "localhost/"},
+			})
+
+			err := hc.Check(UnixHostPrefix + tlsLis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should verify certificate against Host over tls on unix socket", func() {
+			tlsLis, rootCAs := serveTls("myhost")
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Host:       "myhost",
+				TlsEnabled: true,
+				TlsConfig: &tls.Config{
+					RootCAs: rootCAs,
+				},
+				Receive: &Payload{Text: "myhost/"},
+			})
+
+			err := hc.Check(UnixHostPrefix + tlsLis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Context("H2c Server", func() {
+		var server *http.Server
+		var lis net.Listener
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("tcp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			server = &http.Server{
+				Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte(req.Proto))
+				}), &http2.Server{}),
+			}
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should use h2c with prior knowledge when HTTP2 is requested without tls", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				CodecClientType: CodecClientType_HTTP2,
+				StrictProtocol:  true,
+				Receive:         &Payload{Text: "HTTP/2.0"},
+			})
+
+			result, err := hc.CheckWithResult(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(result.Protocol).To(Equal("HTTP/2.0"))
+		})
+		It("should use HTTP1 when HTTP1 is requested", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				StrictProtocol: true,
+			})
+
+			result, err := hc.CheckWithResult(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(result.Protocol).To(Equal("HTTP/1.1"))
+		})
+	})
+
+	Context("Http3 Server", func() {
+		var server *http3.Server
+		var conn net.PacketConn
+		BeforeEach(func() {
+			var err error
+			cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+			Expect(err).To(BeNil())
+			conn, err = net.ListenPacket("udp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			server = &http3.Server{
+				TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+					Certificates: []tls.Certificate{cert},
+				}),
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte("OK"))
+				}),
+			}
+			go server.Serve(conn)
+		})
+		AfterEach(func() {
+			server.Close()
+			conn.Close()
+		})
+		It("should check over HTTP3", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				CodecClientType: CodecClientType_HTTP3,
+				StrictProtocol:  true,
+				TlsEnabled:      true,
+				TlsConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+				Timeout: 2 * time.Second,
+			})
+
+			result, err := hc.CheckWithResult(conn.LocalAddr().String())
+			Expect(err).To(BeNil())
+			Expect(result.Protocol).To(Equal("HTTP/3.0"))
+		})
+		It("should return an error when tls is not enabled", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				CodecClientType: CodecClientType_HTTP3,
+			})
+
+			err := hc.Check(conn.LocalAddr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("requires tls"))
 		})
 	})
 
@@ -195,6 +766,22 @@ var _ = Describe("Http", func() {
 			Expect(err).ToNot(BeNil())
 			Expect(err.Error()).To(ContainSubstring("400"))
 		})
+		It("should return an error when negotiated protocol differs in strict mode", func() {
+			server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+
+			hc := NewHttpHealthCheck(&HttpOpt{
+				CodecClientType: CodecClientType_HTTP2,
+				StrictProtocol:  true,
+				TlsEnabled:      true,
+				TlsConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("differs from requested HTTP2"))
+		})
 		It("should return nil on the most basic test on path / and 200 status code", func() {
 			server.AppendHandlers(ghttp.RespondWith(200, "OK"))
 
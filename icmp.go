@@ -1,6 +1,7 @@
 package gohc
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
@@ -9,6 +10,7 @@ import (
 	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -31,16 +33,30 @@ func getSeed() int64 {
 	return atomic.AddInt64(&seed, 1)
 }
 
+// IcmpResult gives details on an ICMP check.
+type IcmpResult struct {
+	// DnsDuration time spent resolving host, 0 if host is an ip
+	DnsDuration time.Duration
+	// Duration of the check
+	Duration time.Duration
+}
+
 type IcmpOpt struct {
 	// Timeout for ping response. If left empty (default to 5s)
 	Timeout time.Duration
 	// Delay specifies the delay between ICMP reply read try. If left empty (default to 1s)
 	Delay time.Duration
+	// Network if set, describes source address, interface and socket options used by ICMP socket.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
 }
 
 type IcmpHealthCheck struct {
 	opt *IcmpOpt
 	r   *rand.Rand
+	// rand.Rand is not safe for concurrent use
+	rMu sync.Mutex
 }
 
 func NewIcmpHealthCheck(opt *IcmpOpt) *IcmpHealthCheck {
@@ -50,7 +66,7 @@ func NewIcmpHealthCheck(opt *IcmpOpt) *IcmpHealthCheck {
 	}
 }
 
-func (h *IcmpHealthCheck) listen(isIpv6 bool) (*icmp.PacketConn, error) {
+func (h *IcmpHealthCheck) listen(isIpv6 bool) (net.PacketConn, error) {
 	timeout := h.opt.Timeout
 	if timeout == 0 {
 		timeout = 5 * time.Second
@@ -63,10 +79,24 @@ func (h *IcmpHealthCheck) listen(isIpv6 bool) (*icmp.PacketConn, error) {
 		address = "::"
 	}
 
-	return icmp.ListenPacket(network, address)
+	return listenIcmp(h.opt.Network, network, address)
 }
 
 func (h *IcmpHealthCheck) Check(host string) error {
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// CheckWithResult runs the check as Check does and gives details on the check.
+func (h *IcmpHealthCheck) CheckWithResult(host string) (*IcmpResult, error) {
+	start := time.Now()
+	result := &IcmpResult{}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+func (h *IcmpHealthCheck) check(host string, result *IcmpResult) error {
 	rawHost, _, err := net.SplitHostPort(host)
 	if err != nil && !strings.Contains(err.Error(), "missing port in address") {
 		return err
@@ -75,13 +105,10 @@ func (h *IcmpHealthCheck) Check(host string) error {
 		host = rawHost
 	}
 
-	ips, err := net.LookupIP(host)
+	ctx := withDnsDuration(context.Background(), &result.DnsDuration)
+	ips, err := newResolver(h.opt.Resolver).lookup(ctx, host)
 	if err != nil {
-		panic(err.Error())
-	}
-
-	if len(ips) == 0 {
-		return fmt.Errorf("no ip found for %s", host)
+		return err
 	}
 	ip := ips[0]
 	conn, err := h.listen(strings.Contains(ip.String(), ":"))
@@ -97,7 +124,7 @@ func (h *IcmpHealthCheck) Check(host string) error {
 }
 
 func (h *IcmpHealthCheck) recvICMP(
-	conn *icmp.PacketConn,
+	conn net.PacketConn,
 	recv chan<- *packet,
 	done <-chan struct{},
 ) error {
@@ -134,7 +161,7 @@ func (h *IcmpHealthCheck) recvICMP(
 	}
 }
 
-func (h *IcmpHealthCheck) ping(conn *icmp.PacketConn, ip net.IP) error {
+func (h *IcmpHealthCheck) ping(conn net.PacketConn, ip net.IP) error {
 	recv := make(chan *packet, 5)
 	done := make(chan struct{})
 	defer close(done)
@@ -147,7 +174,9 @@ func (h *IcmpHealthCheck) ping(conn *icmp.PacketConn, ip net.IP) error {
 		proto = protocolIPv6ICMP
 	}
 
+	h.rMu.Lock()
 	id := h.r.Intn(math.MaxUint16)
+	h.rMu.Unlock()
 	msg := &icmp.Message{
 		Type: icmpType,
 		Code: 0,
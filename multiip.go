@@ -0,0 +1,362 @@
+package gohc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+type IpFamily int
+
+const (
+	// IpFamilyAll check all addresses, ipv4 and ipv6
+	IpFamilyAll IpFamily = iota
+	// IpFamilyV4 check only ipv4 addresses
+	IpFamilyV4
+	// IpFamilyV6 check only ipv6 addresses
+	IpFamilyV6
+	// IpFamilyPreferV4 check only ipv4 addresses if there is at least one, otherwise ipv6 addresses
+	IpFamilyPreferV4
+	// IpFamilyPreferV6 check only ipv6 addresses if there is at least one, otherwise ipv4 addresses
+	IpFamilyPreferV6
+)
+
+type IpPolicy int
+
+const (
+	// IpPolicyAll all addresses must pass
+	IpPolicyAll IpPolicy = iota
+	// IpPolicyAny one address must pass, addresses are tried in happy eyeballs style:
+	// ipv6 and ipv4 addresses interleaved, next address started after FallbackDelay or when previous failed,
+	// stops on first success.
+	IpPolicyAny
+	// IpPolicyQuorum more than half of addresses must pass
+	IpPolicyQuorum
+)
+
+var ipPolicyName = map[IpPolicy]string{
+	IpPolicyAll:    "all",
+	IpPolicyAny:    "any",
+	IpPolicyQuorum: "quorum",
+}
+
+// MultiIpOpt Describes how host is resolved and how its addresses are checked.
+type MultiIpOpt struct {
+	// Policy to consider host healthy from its addresses results, default to IpPolicyAll
+	Policy IpPolicy
+	// Family of addresses to check, default to IpFamilyAll
+	Family IpFamily
+	// FallbackDelay with IpPolicyAny, delay before starting check on next address
+	// while previous one is not finished. If left empty (default to 300ms)
+	FallbackDelay time.Duration
+	// Timeout for dns resolution. If left empty (default to 5s)
+	Timeout time.Duration
+	// Resolver if set, describes how host is resolved instead of using system resolver, Family is applied on its result.
+	Resolver *ResolverOpt
+}
+
+// ipPinner is implemented by health checks able to give a copy of themselves connecting to ip whatever
+// host name resolves to, host name is kept for Host header, tls server name and certificate verification.
+type ipPinner interface {
+	pinIp(hostname string, ip net.IP) HealthChecker
+}
+
+// MultiIpHealthCheck resolves host and run the health check on each of its addresses.
+// Http, HttpScenario, Tcp, Grpc and TlsCert health checks are given host name with connection pinned to each address,
+// other health checks are given address as host and must not depend on host name.
+type MultiIpHealthCheck struct {
+	hc  HealthChecker
+	opt *MultiIpOpt
+	// health checks pinned to each ip by host name
+	pinned   map[string]map[string]HealthChecker
+	pinnedMu sync.Mutex
+}
+
+func NewMultiIpHealthCheck(hc HealthChecker, opt *MultiIpOpt) *MultiIpHealthCheck {
+	if opt == nil {
+		opt = &MultiIpOpt{}
+	}
+	return &MultiIpHealthCheck{
+		hc:     hc,
+		opt:    opt,
+		pinned: make(map[string]map[string]HealthChecker),
+	}
+}
+
+func (h *MultiIpHealthCheck) Check(host string) error {
+	_, err := h.CheckIps(host)
+	return err
+}
+
+// CheckIps runs the health check on each address of host and gives results for each address.
+// Host can be given without port, addresses will then be given without port in results.
+// With IpPolicyAny, addresses not yet checked when one passed are not part of results.
+func (h *MultiIpHealthCheck) CheckIps(host string) ([]*HostResult, error) {
+	rawHost, port, err := net.SplitHostPort(host)
+	if err != nil {
+		rawHost = host
+		port = ""
+	}
+	ips, err := h.lookup(rawHost)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, noIpFoundError(rawHost)
+	}
+
+	targets := make([]string, len(ips))
+	for i, ip := range ips {
+		targets[i] = ip.String()
+		if port != "" {
+			targets[i] = net.JoinHostPort(ip.String(), port)
+		}
+	}
+	pinner, pinned := h.hc.(ipPinner)
+	pinned = pinned && net.ParseIP(rawHost) == nil
+	if pinned {
+		h.prunePinned(rawHost, ips)
+	}
+	check := func(index int) *HostResult {
+		if !pinned {
+			return checkHost(h.hc, index, targets[index])
+		}
+		result := checkHost(h.pinnedChecker(pinner, rawHost, ips[index]), index, host)
+		result.Host = targets[index]
+		return result
+	}
+
+	var results []*HostResult
+	if h.opt.Policy == IpPolicyAny {
+		results = h.checkAny(len(targets), check)
+	} else {
+		results = h.checkAll(len(targets), check)
+	}
+	return results, h.evaluate(host, len(targets), results)
+}
+
+// Close closes connections kept by health checks pinned to addresses, the health check given is left open.
+func (h *MultiIpHealthCheck) Close() {
+	h.pinnedMu.Lock()
+	defer h.pinnedMu.Unlock()
+	for hostname, pinnedIps := range h.pinned {
+		for _, hc := range pinnedIps {
+			closeChecker(hc)
+		}
+		delete(h.pinned, hostname)
+	}
+}
+
+// pinnedChecker gives health check pinned to ip for hostname, kept to reuse its connections on next checks
+func (h *MultiIpHealthCheck) pinnedChecker(pinner ipPinner, hostname string, ip net.IP) HealthChecker {
+	h.pinnedMu.Lock()
+	defer h.pinnedMu.Unlock()
+	pinnedIps, ok := h.pinned[hostname]
+	if !ok {
+		pinnedIps = make(map[string]HealthChecker)
+		h.pinned[hostname] = pinnedIps
+	}
+	if hc, ok := pinnedIps[ip.String()]; ok {
+		return hc
+	}
+	hc := pinner.pinIp(hostname, ip)
+	pinnedIps[ip.String()] = hc
+	return hc
+}
+
+// prunePinned closes and forgets health checks pinned to addresses hostname does not resolve to anymore
+func (h *MultiIpHealthCheck) prunePinned(hostname string, ips []net.IP) {
+	current := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		current[ip.String()] = true
+	}
+	h.pinnedMu.Lock()
+	defer h.pinnedMu.Unlock()
+	for ip, hc := range h.pinned[hostname] {
+		if !current[ip] {
+			closeChecker(hc)
+			delete(h.pinned[hostname], ip)
+		}
+	}
+}
+
+// closeChecker closes connections kept by hc if it has any
+func closeChecker(hc HealthChecker) {
+	if closer, ok := hc.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+func (h *MultiIpHealthCheck) lookup(host string) ([]net.IP, error) {
+	timeout := h.opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if h.opt.Resolver != nil {
+		ips, err := newResolver(h.opt.Resolver).lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return filterIps(ips, h.opt.Family), nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("fail to resolve %s: %w", host, err)
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return filterIps(ips, h.opt.Family), nil
+}
+
+// filterIps keeps ips matching family, with IpFamilyAll ipv6 and ipv4 are interleaved
+func filterIps(ips []net.IP, family IpFamily) []net.IP {
+	var ipv4s, ipv6s []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			ipv4s = append(ipv4s, ip)
+			continue
+		}
+		ipv6s = append(ipv6s, ip)
+	}
+	switch family {
+	case IpFamilyV4:
+		return ipv4s
+	case IpFamilyV6:
+		return ipv6s
+	case IpFamilyPreferV4:
+		if len(ipv4s) > 0 {
+			return ipv4s
+		}
+		return ipv6s
+	case IpFamilyPreferV6:
+		if len(ipv6s) > 0 {
+			return ipv6s
+		}
+		return ipv4s
+	}
+	return interleaveIps(ipv6s, ipv4s)
+}
+
+func interleaveIps(first, second []net.IP) []net.IP {
+	ips := make([]net.IP, 0, len(first)+len(second))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			ips = append(ips, first[i])
+		}
+		if i < len(second) {
+			ips = append(ips, second[i])
+		}
+	}
+	return ips
+}
+
+func (h *MultiIpHealthCheck) checkAll(nbTargets int, check func(index int) *HostResult) []*HostResult {
+	resultCh := make(chan *HostResult)
+	for i := 0; i < nbTargets; i++ {
+		go func(index int) {
+			resultCh <- check(index)
+		}(i)
+	}
+	results := make([]*HostResult, nbTargets)
+	for i := 0; i < nbTargets; i++ {
+		result := <-resultCh
+		results[result.Index] = result
+	}
+	return results
+}
+
+func (h *MultiIpHealthCheck) checkAny(nbTargets int, check func(index int) *HostResult) []*HostResult {
+	fallbackDelay := h.opt.FallbackDelay
+	if fallbackDelay == 0 {
+		fallbackDelay = 300 * time.Millisecond
+	}
+	// buffered to not block checks still running when we return
+	resultCh := make(chan *HostResult, nbTargets)
+	next := 0
+	running := 0
+	launch := func() {
+		go func(index int) {
+			resultCh <- check(index)
+		}(next)
+		next++
+		running++
+	}
+
+	var results []*HostResult
+	passed := false
+	launch()
+	for running > 0 && !passed {
+		var fallbackC <-chan time.Time
+		var fallback *time.Timer
+		if next < nbTargets {
+			fallback = time.NewTimer(fallbackDelay)
+			fallbackC = fallback.C
+		}
+		select {
+		case <-fallbackC:
+			launch()
+		case result := <-resultCh:
+			running--
+			results = append(results, result)
+			passed = result.Status != HealthStatusFail
+			if !passed && next < nbTargets {
+				launch()
+			}
+		}
+		if fallback != nil {
+			fallback.Stop()
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Index < results[j].Index
+	})
+	return results
+}
+
+func (h *MultiIpHealthCheck) evaluate(host string, nbTargets int, results []*HostResult) error {
+	var resultErr string
+	var resultWarn string
+	nbPassed := 0
+	nbFailed := 0
+	for _, result := range results {
+		switch result.Status {
+		case HealthStatusFail:
+			nbFailed++
+			resultErr = fmt.Sprintf("%s- %s: %s\n", resultErr, result.Host, result.Err)
+		case HealthStatusWarn:
+			nbPassed++
+			resultWarn = fmt.Sprintf("%s- %s: %s\n", resultWarn, result.Host, result.Err)
+		default:
+			nbPassed++
+		}
+	}
+
+	var healthy bool
+	switch h.opt.Policy {
+	case IpPolicyAny:
+		healthy = nbPassed > 0
+	case IpPolicyQuorum:
+		healthy = nbPassed > nbTargets/2
+	default:
+		healthy = nbFailed == 0
+	}
+	if !healthy {
+		return fmt.Errorf("policy %s not satisfied for host '%s', %d/%d addresses passed:\n%s",
+			ipPolicyName[h.opt.Policy], host, nbPassed, nbTargets, resultErr)
+	}
+	if resultWarn != "" {
+		return NewWarnError("warnings on addresses for host '%s':\n%s", host, resultWarn)
+	}
+	return nil
+}
+
+func (h *MultiIpHealthCheck) String() string {
+	return fmt.Sprintf("MultiIpHealthCheck(%v)", h.hc)
+}
@@ -0,0 +1,166 @@
+package gohc_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+var _ = Describe("MultiIp", func() {
+	var lis net.Listener
+	BeforeEach(func() {
+		var err error
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		lis.Close()
+	})
+	It("should resolve hostname and check each address", func() {
+		_, port, err := net.SplitHostPort(lis.Addr().String())
+		Expect(err).To(BeNil())
+		hc := NewMultiIpHealthCheck(NewTcpHealthCheck(&TcpOpt{}), &MultiIpOpt{
+			Family: IpFamilyV4,
+		})
+
+		results, err := hc.CheckIps(net.JoinHostPort("localhost", port))
+		Expect(err).To(BeNil())
+		Expect(results).ToNot(BeEmpty())
+		Expect(results[0].Host).To(Equal(net.JoinHostPort("127.0.0.1", port)))
+		Expect(results[0].Status).To(Equal(HealthStatusPass))
+	})
+	It("should keep host name for http host header and tls verification", func() {
+		server := ghttp.NewTLSServer()
+		defer server.Close()
+		server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+		_, port, err := net.SplitHostPort(urlToHost(server.URL()))
+		Expect(err).To(BeNil())
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(server.HTTPTestServer.Certificate())
+		hc := NewMultiIpHealthCheck(NewHttpHealthCheck(&HttpOpt{
+			TlsEnabled: true,
+			TlsConfig: &tls.Config{
+				RootCAs: rootCAs,
+			},
+		}), &MultiIpOpt{
+			Resolver: &ResolverOpt{
+				Static: map[string][]string{
+					"example.com": {"127.0.0.1"},
+				},
+			},
+		})
+
+		results, err := hc.CheckIps("example.com:" + port)
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Host).To(Equal(net.JoinHostPort("127.0.0.1", port)))
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+		Expect(server.ReceivedRequests()[0].Host).To(Equal("example.com:" + port))
+		Expect(server.ReceivedRequests()[0].TLS.ServerName).To(Equal("example.com"))
+	})
+	It("should pass address without port when host has no port", func() {
+		hc := NewMultiIpHealthCheck(NewTestHealthCheck(), &MultiIpOpt{})
+
+		results, err := hc.CheckIps("127.0.0.1")
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Host).To(Equal("127.0.0.1"))
+	})
+	It("should return an error when no address match family", func() {
+		hc := NewMultiIpHealthCheck(NewTestHealthCheck(), &MultiIpOpt{
+			Family: IpFamilyV6,
+		})
+
+		err := hc.Check("127.0.0.1:80")
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("no ip found"))
+		Expect(ClassifyError(err)).To(Equal(FailureClassDns))
+	})
+	It("should return an error when policy is not satisfied", func() {
+		lis.Close()
+		hc := NewMultiIpHealthCheck(NewTcpHealthCheck(&TcpOpt{}), &MultiIpOpt{
+			Policy: IpPolicyAny,
+		})
+
+		results, err := hc.CheckIps(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("policy any not satisfied"))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Status).To(Equal(HealthStatusFail))
+	})
+	It("should default options when not set", func() {
+		hc := NewMultiIpHealthCheck(NewTestHealthCheck(), nil)
+
+		err := hc.Check("127.0.0.1:80")
+		Expect(err).To(BeNil())
+	})
+	Context("with checks pinned to addresses", func() {
+		var server *http.Server
+		var port string
+		var closedConns int64
+		var static map[string][]string
+		BeforeEach(func() {
+			httpLis, err := net.Listen("tcp4", "0.0.0.0:0")
+			Expect(err).To(BeNil())
+			_, port, _ = net.SplitHostPort(httpLis.Addr().String())
+			atomic.StoreInt64(&closedConns, 0)
+			server = &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				ConnState: func(_ net.Conn, state http.ConnState) {
+					if state == http.StateClosed {
+						atomic.AddInt64(&closedConns, 1)
+					}
+				},
+			}
+			go server.Serve(httpLis)
+			static = map[string][]string{
+				"example.com": {"127.0.0.1"},
+			}
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should close connections to addresses host does not resolve to anymore", func() {
+			hc := NewMultiIpHealthCheck(NewHttpHealthCheck(&HttpOpt{}), &MultiIpOpt{
+				Resolver: &ResolverOpt{Static: static},
+			})
+			defer hc.Close()
+
+			err := hc.Check("example.com:" + port)
+			Expect(err).To(BeNil())
+			Expect(atomic.LoadInt64(&closedConns)).To(Equal(int64(0)))
+
+			static["example.com"] = []string{"127.0.0.2"}
+			err = hc.Check("example.com:" + port)
+			Expect(err).To(BeNil())
+			testhelpers.EventuallyAtomic(&closedConns).Should(Equal(1))
+		})
+		It("should close connections of checks pinned when closed", func() {
+			hc := NewMultiIpHealthCheck(NewHttpHealthCheck(&HttpOpt{}), &MultiIpOpt{
+				Resolver: &ResolverOpt{Static: static},
+			})
+
+			err := hc.Check("example.com:" + port)
+			Expect(err).To(BeNil())
+
+			hc.Close()
+			testhelpers.EventuallyAtomic(&closedConns).Should(Equal(1))
+		})
+	})
+	It("should return a warning when address check return a warning", func() {
+		hc := NewMultiIpHealthCheck(NonCritical(NewTestHealthCheckErr()), &MultiIpOpt{
+			Policy: IpPolicyQuorum,
+		})
+
+		err := hc.Check("127.0.0.1:80")
+		Expect(err).ToNot(BeNil())
+		Expect(IsWarning(err)).To(BeTrue())
+	})
+})
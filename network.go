@@ -0,0 +1,106 @@
+package gohc
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/net/icmp"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// NetworkOpt Describes how connections made by a check egress from host (e.g.: on multi-homed hosts).
+type NetworkOpt struct {
+	// LocalAddr source ip used by connections (e.g.: 10.0.0.2). If left empty (default to ip chosen by system)
+	LocalAddr string
+	// BindToDevice name of interface or VRF sockets are bound to (SO_BINDTODEVICE), only supported on linux.
+	BindToDevice string
+	// Mark set on sockets for policy routing (SO_MARK), only supported on linux.
+	Mark uint32
+	// Tos set in IP TOS byte or IPv6 traffic class (e.g.: 0xb8 for DSCP EF), only supported on linux.
+	Tos int
+	// Ttl set as IP TTL or IPv6 hop limit, only supported on linux. If left empty (default to system value)
+	Ttl int
+}
+
+func (o *NetworkOpt) hasSocketOptions() bool {
+	return o.BindToDevice != "" || o.Mark != 0 || o.Tos != 0 || o.Ttl != 0
+}
+
+// localAddr gives address to bind for network, nil if LocalAddr is not set or network is unix
+func (o *NetworkOpt) localAddr(network string) (net.Addr, error) {
+	if o.LocalAddr == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(o.LocalAddr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid local address '%s'", o.LocalAddr)
+	}
+	switch {
+	case strings.HasPrefix(network, "tcp"):
+		return &net.TCPAddr{IP: ip}, nil
+	case strings.HasPrefix(network, "udp"):
+		return &net.UDPAddr{IP: ip}, nil
+	case strings.HasPrefix(network, "ip"):
+		return &net.IPAddr{IP: ip}, nil
+	}
+	return nil, nil
+}
+
+// control applies socket options on sockets before they are connected or bound
+func (o *NetworkOpt) control(network, _ string, c syscall.RawConn) error {
+	if strings.HasPrefix(network, "unix") || !o.hasSocketOptions() {
+		return nil
+	}
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = setSocketOptions(fd, o)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// makeNetworkDial gives a dial function from dialer applying network options, opt can be nil
+func makeNetworkDial(opt *NetworkOpt, dialer *net.Dialer) dialContextFunc {
+	if opt == nil {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		localAddr, err := opt.localAddr(network)
+		if err != nil {
+			return nil, err
+		}
+		d := *dialer
+		d.Control = opt.control
+		if localAddr != nil {
+			d.LocalAddr = localAddr
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
+
+// listenIcmp listens for ICMP packets as icmp.ListenPacket does, applying network options, opt can be nil
+func listenIcmp(opt *NetworkOpt, network, address string) (net.PacketConn, error) {
+	if opt == nil {
+		return icmp.ListenPacket(network, address)
+	}
+	if opt.LocalAddr != "" {
+		if net.ParseIP(opt.LocalAddr) == nil {
+			return nil, fmt.Errorf("invalid local address '%s'", opt.LocalAddr)
+		}
+		address = opt.LocalAddr
+	}
+	if !opt.hasSocketOptions() {
+		return icmp.ListenPacket(network, address)
+	}
+	// privileged raw sockets can be made by net package, datagram-oriented ones can't
+	if strings.HasPrefix(network, "ip") {
+		listenConfig := &net.ListenConfig{
+			Control: opt.control,
+		}
+		return listenConfig.ListenPacket(context.Background(), network, address)
+	}
+	return listenIcmpDatagram(opt, network, address)
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package gohc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+func setSocketOptions(fd uintptr, opt *NetworkOpt) error {
+	s := int(fd)
+	if opt.BindToDevice != "" {
+		err := syscall.SetsockoptString(s, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, opt.BindToDevice)
+		if err != nil {
+			return fmt.Errorf("fail to bind to device '%s': %w", opt.BindToDevice, err)
+		}
+	}
+	if opt.Mark != 0 {
+		err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_MARK, int(opt.Mark))
+		if err != nil {
+			return fmt.Errorf("fail to set mark %d: %w", opt.Mark, err)
+		}
+	}
+	if opt.Tos == 0 && opt.Ttl == 0 {
+		return nil
+	}
+	domain, err := syscall.GetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+	if err != nil {
+		return err
+	}
+	level, tosOpt, ttlOpt := syscall.IPPROTO_IP, syscall.IP_TOS, syscall.IP_TTL
+	if domain == syscall.AF_INET6 {
+		level, tosOpt, ttlOpt = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, syscall.IPV6_UNICAST_HOPS
+	}
+	if opt.Tos != 0 {
+		err = syscall.SetsockoptInt(s, level, tosOpt, opt.Tos)
+		if err != nil {
+			return fmt.Errorf("fail to set tos %d: %w", opt.Tos, err)
+		}
+	}
+	if opt.Ttl != 0 {
+		err = syscall.SetsockoptInt(s, level, ttlOpt, opt.Ttl)
+		if err != nil {
+			return fmt.Errorf("fail to set ttl %d: %w", opt.Ttl, err)
+		}
+	}
+	return nil
+}
+
+// listenIcmpDatagram creates a non-privileged datagram-oriented ICMP endpoint as icmp.ListenPacket does
+// with socket options applied before bind.
+func listenIcmpDatagram(opt *NetworkOpt, network, address string) (net.PacketConn, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address '%s'", address)
+	}
+	var family, proto int
+	var sa syscall.Sockaddr
+	switch network {
+	case "udp4":
+		family, proto = syscall.AF_INET, protocolICMP
+		sa4 := &syscall.SockaddrInet4{}
+		copy(sa4.Addr[:], ip.To4())
+		sa = sa4
+	case "udp6":
+		family, proto = syscall.AF_INET6, protocolIPv6ICMP
+		sa6 := &syscall.SockaddrInet6{}
+		copy(sa6.Addr[:], ip.To16())
+		sa = sa6
+	default:
+		return nil, fmt.Errorf("unsupported network '%s'", network)
+	}
+	s, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	err = setSocketOptions(uintptr(s), opt)
+	if err != nil {
+		syscall.Close(s)
+		return nil, err
+	}
+	err = syscall.Bind(s, sa)
+	if err != nil {
+		syscall.Close(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	f := os.NewFile(uintptr(s), "datagram-oriented icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
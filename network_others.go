@@ -0,0 +1,16 @@
+//go:build !linux
+
+package gohc
+
+import (
+	"fmt"
+	"net"
+)
+
+func setSocketOptions(_ uintptr, _ *NetworkOpt) error {
+	return fmt.Errorf("BindToDevice, Mark, Tos and Ttl network options are only supported on linux")
+}
+
+func listenIcmpDatagram(opt *NetworkOpt, _, _ string) (net.PacketConn, error) {
+	return nil, setSocketOptions(0, opt)
+}
@@ -0,0 +1,155 @@
+package gohc_test
+
+import (
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"golang.org/x/net/ipv4"
+	"net"
+	"runtime"
+	"sync"
+)
+
+var _ = Describe("Network", func() {
+	BeforeEach(func() {
+		if runtime.GOOS != "linux" {
+			Skip("network options are only supported on linux")
+		}
+	})
+	Context("Tcp", func() {
+		var lis net.Listener
+		var mu sync.Mutex
+		var remoteAddrs []string
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("tcp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			remoteAddrs = nil
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				mu.Lock()
+				remoteAddrs = append(remoteAddrs, conn.RemoteAddr().(*net.TCPAddr).IP.String())
+				mu.Unlock()
+				conn.Write([]byte("hello\n"))
+			})
+		})
+		AfterEach(func() {
+			lis.Close()
+		})
+		It("should connect from local address", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Network: &NetworkOpt{
+					LocalAddr: "127.0.0.2",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(remoteAddrs).To(Equal([]string{"127.0.0.2"}))
+		})
+		It("should connect with tos and ttl set", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Network: &NetworkOpt{
+					Tos: 0xb8,
+					Ttl: 42,
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should return an error when local address is invalid", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Network: &NetworkOpt{
+					LocalAddr: "not-an-ip",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("invalid local address 'not-an-ip'"))
+		})
+		It("should return an error when device does not exist", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Network: &NetworkOpt{
+					BindToDevice: "gohc-none0",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("fail to bind to device 'gohc-none0'"))
+		})
+	})
+	Context("Http", func() {
+		var server *ghttp.Server
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should send request from local address", func() {
+			server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+			hc := NewHttpHealthCheck(&HttpOpt{
+				Network: &NetworkOpt{
+					LocalAddr: "127.0.0.3",
+				},
+			})
+
+			err := hc.Check(urlToHost(server.URL()))
+			Expect(err).To(BeNil())
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+			host, _, _ := net.SplitHostPort(server.ReceivedRequests()[0].RemoteAddr)
+			Expect(host).To(Equal("127.0.0.3"))
+		})
+	})
+	Context("Udp", func() {
+		var conn *ipv4.PacketConn
+		var received chan *ipv4.ControlMessage
+		var peers chan net.Addr
+		BeforeEach(func() {
+			udpConn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			Expect(err).To(BeNil())
+			conn = ipv4.NewPacketConn(udpConn)
+			Expect(conn.SetControlMessage(ipv4.FlagTTL, true)).To(BeNil())
+			received = make(chan *ipv4.ControlMessage, 1)
+			peers = make(chan net.Addr, 1)
+			go func() {
+				buf := make([]byte, 1500)
+				for {
+					_, cm, peer, err := conn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					received <- cm
+					peers <- peer
+					conn.WriteTo([]byte("pong"), nil, peer)
+				}
+			}()
+		})
+		AfterEach(func() {
+			conn.Close()
+		})
+		It("should send datagram with ttl from local address", func() {
+			hc := NewUdpHealthCheck(&UdpOpt{
+				Network: &NetworkOpt{
+					LocalAddr: "127.0.0.4",
+					Ttl:       42,
+				},
+				Receive: []*Payload{{Text: "pong"}},
+			})
+
+			err := hc.Check(conn.LocalAddr().String())
+			Expect(err).To(BeNil())
+			cm := <-received
+			Expect(cm.TTL).To(Equal(42))
+			peer := <-peers
+			Expect(peer.(*net.UDPAddr).IP.String()).To(Equal("127.0.0.4"))
+		})
+	})
+})
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"time"
 )
 
+// ProgramExitCodeWarning is the exit code, following nagios plugin convention, that a program must return
+// to report a degraded state. Check will then return a WarnError.
+const ProgramExitCodeWarning = 1
+
 type ProgramTlsOpt struct {
 	// Set to true to not verify the server's certificate. This is strongly discouraged.
 	InsecureSkipVerify bool
@@ -33,6 +38,8 @@ type ProgramOpt struct {
 	// AltPort specifies the port to use for gRPC health check requests.
 	// If left empty it taks the port from host during check.
 	AltPort uint32
+	// Templated set to true to render Args as go templates with TemplateVars (e.g.: "--host={{.Host}}").
+	Templated bool
 }
 
 type ProgramHealthCheck struct {
@@ -87,7 +94,19 @@ func (h *ProgramHealthCheck) Check(host string) error {
 	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
 	defer cancelFunc()
 
-	cmd := exec.CommandContext(ctx, h.opt.Path, h.opt.Args...)
+	args := h.opt.Args
+	if h.opt.Templated {
+		vars, err := newTemplateVars(host)
+		if err != nil {
+			return err
+		}
+		args, err = vars.renderStrings(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, h.opt.Path, args...)
 	output := &bytes.Buffer{}
 	input := bytes.NewBuffer(dataJson)
 
@@ -96,6 +115,10 @@ func (h *ProgramHealthCheck) Check(host string) error {
 	cmd.Stdin = input
 
 	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == ProgramExitCodeWarning {
+		return NewWarnError("program health check warning, output from program: %s", output.String())
+	}
 	if err != nil {
 		return fmt.Errorf("program health check failed: %s, output from program: %s",
 			err.Error(),
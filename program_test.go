@@ -25,6 +25,38 @@ var _ = Describe("Program", func() {
 			Expect(err.Error()).To(ContainSubstring(`"timeout_seconds":5,`))
 			Expect(err.Error()).To(ContainSubstring(`"test":"test"`))
 		})
+		It("should return a warning when program exit with code 1", func() {
+			hc := NewProgramHealthCheck(&ProgramOpt{
+				Path: "bash",
+				Args: []string{"-c", "echo degraded && exit 1"},
+			})
+
+			err := hc.Check("127.0.0.1:8080")
+			Expect(err).To(HaveOccurred())
+			Expect(IsWarning(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("degraded"))
+		})
+		It("should return a failure when program exit with code 2", func() {
+			hc := NewProgramHealthCheck(&ProgramOpt{
+				Path: "bash",
+				Args: []string{"-c", "exit 2"},
+			})
+
+			err := hc.Check("127.0.0.1:8080")
+			Expect(err).To(HaveOccurred())
+			Expect(StatusFromError(err)).To(Equal(HealthStatusFail))
+		})
+		It("should render args when templated", func() {
+			hc := NewProgramHealthCheck(&ProgramOpt{
+				Path:      "bash",
+				Args:      []string{"-c", "echo $0 && exit 2", "{{.Host}}-{{.Port}}"},
+				Templated: true,
+			})
+
+			err := hc.Check("127.0.0.1:8080")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("127.0.0.1-8080"))
+		})
 		When("set an alternative port", func() {
 			It("should receive host with alternative port", func() {
 				hc := NewProgramHealthCheck(&ProgramOpt{
@@ -0,0 +1,168 @@
+package gohc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+type ProxyProtocolVersion int32
+
+const (
+	// ProxyProtocolV1 sends human-readable header (e.g.: PROXY TCP4 192.168.0.1 192.168.0.11 56324 443)
+	ProxyProtocolV1 ProxyProtocolVersion = 1
+	// ProxyProtocolV2 sends binary header which can contain TLVs
+	ProxyProtocolV2 ProxyProtocolVersion = 2
+)
+
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyProtocolTlv is a Type-Length-Value added to a PROXY protocol v2 header (e.g.: type 0x02 for authority).
+type ProxyProtocolTlv struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyProtocolOpt Describes the PROXY protocol header sent at the beginning of each connection.
+type ProxyProtocolOpt struct {
+	// Version of PROXY protocol. If left empty (default to ProxyProtocolV1)
+	Version ProxyProtocolVersion
+	// SourceAddr source address announced as ip:port. If left empty (default to local address of connection)
+	SourceAddr string
+	// DestinationAddr destination address announced as ip:port. If left empty (default to remote address of connection)
+	DestinationAddr string
+	// Tlvs added to header, only with ProxyProtocolV2.
+	Tlvs []*ProxyProtocolTlv
+}
+
+// wrapDialProxyProtocol gives a dial function sending PROXY protocol header on each new connection
+func wrapDialProxyProtocol(opt *ProxyProtocolOpt, dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		header, err := makeProxyProtocolHeader(opt, conn.LocalAddr(), conn.RemoteAddr())
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		_, err = conn.Write(header)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("fail to send PROXY protocol header: %w", err)
+		}
+		return conn, nil
+	}
+}
+
+func makeProxyProtocolHeader(opt *ProxyProtocolOpt, localAddr, remoteAddr net.Addr) ([]byte, error) {
+	src, err := proxyProtocolAddr(opt.SourceAddr, localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol source address: %w", err)
+	}
+	dst, err := proxyProtocolAddr(opt.DestinationAddr, remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol destination address: %w", err)
+	}
+	// both addresses must be of the same family, ipv4 address is sent as ipv4-mapped ipv6 address if families differ
+	isV6 := src != nil && dst != nil && (src.IP.To4() == nil || dst.IP.To4() == nil)
+	switch opt.Version {
+	case ProxyProtocolV1, 0:
+		if len(opt.Tlvs) > 0 {
+			return nil, fmt.Errorf("PROXY protocol TLVs are only supported with version 2")
+		}
+		return makeProxyProtocolV1Header(src, dst, isV6), nil
+	case ProxyProtocolV2:
+		return makeProxyProtocolV2Header(src, dst, isV6, opt.Tlvs)
+	}
+	return nil, fmt.Errorf("unsupported PROXY protocol version %d", opt.Version)
+}
+
+// proxyProtocolAddr gives address from value or from connection address, nil if address is not tcp (e.g.: unix socket)
+func proxyProtocolAddr(value string, connAddr net.Addr) (*net.TCPAddr, error) {
+	if value == "" {
+		tcpAddr, ok := connAddr.(*net.TCPAddr)
+		if !ok {
+			return nil, nil
+		}
+		return &net.TCPAddr{IP: tcpAddr.IP, Port: tcpAddr.Port}, nil
+	}
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("'%s' is not an ip", host)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port '%s'", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(portNum)}, nil
+}
+
+func makeProxyProtocolV1Header(src, dst *net.TCPAddr, isV6 bool) []byte {
+	if src == nil || dst == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	if !isV6 {
+		return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n", src.IP, dst.IP, src.Port, dst.Port))
+	}
+	return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n", proxyProtocolV1Ipv6(src.IP), proxyProtocolV1Ipv6(dst.IP), src.Port, dst.Port))
+}
+
+// proxyProtocolV1Ipv6 formats ip as ipv6, go formats ipv4-mapped addresses as ipv4
+func proxyProtocolV1Ipv6(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+func makeProxyProtocolV2Header(src, dst *net.TCPAddr, isV6 bool, tlvs []*ProxyProtocolTlv) ([]byte, error) {
+	payload := &bytes.Buffer{}
+	// version 2 and PROXY command
+	verCmd := byte(0x21)
+	// unspecified family and protocol
+	family := byte(0x00)
+	switch {
+	case src == nil || dst == nil:
+	case !isV6:
+		// TCP over IPv4
+		family = 0x11
+		payload.Write(src.IP.To4())
+		payload.Write(dst.IP.To4())
+	default:
+		// TCP over IPv6
+		family = 0x21
+		payload.Write(src.IP.To16())
+		payload.Write(dst.IP.To16())
+	}
+	if family != 0x00 {
+		binary.Write(payload, binary.BigEndian, uint16(src.Port))
+		binary.Write(payload, binary.BigEndian, uint16(dst.Port))
+	}
+	for _, tlv := range tlvs {
+		if len(tlv.Value) > 0xffff {
+			return nil, fmt.Errorf("PROXY protocol TLV 0x%x value is too long", tlv.Type)
+		}
+		payload.WriteByte(tlv.Type)
+		binary.Write(payload, binary.BigEndian, uint16(len(tlv.Value)))
+		payload.Write(tlv.Value)
+	}
+	if payload.Len() > 0xffff {
+		return nil, fmt.Errorf("PROXY protocol header is too long")
+	}
+	header := &bytes.Buffer{}
+	header.Write(proxyProtocolV2Signature)
+	header.WriteByte(verCmd)
+	header.WriteByte(family)
+	binary.Write(header, binary.BigEndian, uint16(payload.Len()))
+	header.Write(payload.Bytes())
+	return header.Bytes(), nil
+}
@@ -0,0 +1,229 @@
+package gohc_test
+
+import (
+	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
+)
+
+var _ = Describe("ProxyProtocol", func() {
+	var lis *testhelpers.ProxyProtocolListener
+	BeforeEach(func() {
+		tcpLis, err := net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		lis = testhelpers.NewProxyProtocolListener(tcpLis)
+	})
+	AfterEach(func() {
+		lis.Close()
+	})
+	Context("Tcp", func() {
+		BeforeEach(func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("hello\n"))
+			})
+		})
+		It("should send v1 header with connection addresses by default", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{},
+				Receive:       []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			header := lis.Headers()[0]
+			Expect(header.Version).To(Equal(1))
+			Expect(header.Family).To(Equal("TCP4"))
+			Expect(header.DestinationAddr).To(Equal(lis.Addr().String()))
+			Expect(header.SourceAddr).To(HavePrefix("127.0.0.1:"))
+		})
+		It("should send v1 header with configured addresses", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version:         ProxyProtocolV1,
+					SourceAddr:      "2001:db8::1:56324",
+					DestinationAddr: "[2001:db8::2]:443",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("invalid PROXY protocol source address"))
+
+			hc = NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version:         ProxyProtocolV1,
+					SourceAddr:      "[2001:db8::1]:56324",
+					DestinationAddr: "[2001:db8::2]:443",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err = hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			header := lis.Headers()[0]
+			Expect(header.Family).To(Equal("TCP6"))
+			Expect(header.SourceAddr).To(Equal("[2001:db8::1]:56324"))
+			Expect(header.DestinationAddr).To(Equal("[2001:db8::2]:443"))
+		})
+		It("should send ipv4 address as ipv4-mapped ipv6 address when families differ", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					SourceAddr:      "10.0.0.1:1234",
+					DestinationAddr: "[2001:db8::1]:80",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			header := lis.Headers()[0]
+			Expect(header.Family).To(Equal("TCP6"))
+			Expect(header.SourceAddr).To(Equal("[::ffff:10.0.0.1]:1234"))
+			Expect(header.DestinationAddr).To(Equal("[2001:db8::1]:80"))
+
+			hc = NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version:         ProxyProtocolV2,
+					SourceAddr:      "[2001:db8::1]:1234",
+					DestinationAddr: "10.0.0.1:80",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err = hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(2))
+			header = lis.Headers()[1]
+			Expect(header.Family).To(Equal("TCP6"))
+			Expect(header.SourceAddr).To(Equal("[2001:db8::1]:1234"))
+			// go formats ipv4-mapped addresses as ipv4
+			Expect(header.DestinationAddr).To(Equal("10.0.0.1:80"))
+			Expect(header.Tlvs).To(BeEmpty())
+		})
+		It("should send v2 header with tlvs", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version:    ProxyProtocolV2,
+					SourceAddr: "192.168.0.1:56324",
+					Tlvs: []*ProxyProtocolTlv{
+						{Type: 0x02, Value: []byte("example.com")},
+						{Type: 0xE0, Value: []byte{0x01, 0x02}},
+					},
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			header := lis.Headers()[0]
+			Expect(header.Version).To(Equal(2))
+			Expect(header.Family).To(Equal("TCP4"))
+			Expect(header.SourceAddr).To(Equal("192.168.0.1:56324"))
+			Expect(header.DestinationAddr).To(Equal(lis.Addr().String()))
+			Expect(header.Tlvs).To(HaveKeyWithValue(byte(0x02), []byte("example.com")))
+			Expect(header.Tlvs).To(HaveKeyWithValue(byte(0xE0), []byte{0x01, 0x02}))
+		})
+		It("should send v2 header in ipv6 when families are mixed", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version:    ProxyProtocolV2,
+					SourceAddr: "[2001:db8::1]:56324",
+				},
+				Receive: []*Payload{{Text: "hello"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			header := lis.Headers()[0]
+			Expect(header.Family).To(Equal("TCP6"))
+			Expect(header.SourceAddr).To(Equal("[2001:db8::1]:56324"))
+			// ipv4-mapped address is displayed as ipv4 by go
+			Expect(header.DestinationAddr).To(Equal(lis.Addr().String()))
+		})
+		It("should return an error when tlvs are set with v1", func() {
+			hc := NewTcpHealthCheck(&TcpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Tlvs: []*ProxyProtocolTlv{{Type: 0x02, Value: []byte("example.com")}},
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("TLVs are only supported with version 2"))
+		})
+	})
+	Context("Http", func() {
+		var server *http.Server
+		BeforeEach(func() {
+			server = &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+			}
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should send header once per connection", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					Version: ProxyProtocolV2,
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			err = hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			Expect(lis.Headers()[0].DestinationAddr).To(Equal(lis.Addr().String()))
+		})
+		It("should return an error with HTTP3", func() {
+			hc := NewHttpHealthCheck(&HttpOpt{
+				TlsEnabled:      true,
+				CodecClientType: CodecClientType_HTTP3,
+				ProxyProtocol:   &ProxyProtocolOpt{},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("PROXY protocol is not supported with HTTP3"))
+		})
+	})
+	Context("Grpc", func() {
+		var server *grpc.Server
+		BeforeEach(func() {
+			server = grpc.NewServer()
+			healthpb.RegisterHealthServer(server, health.NewServer())
+			go server.Serve(lis)
+		})
+		AfterEach(func() {
+			server.Stop()
+		})
+		It("should send header before http2 preface", func() {
+			hc := NewGrpcHealthCheck(&GrpcOpt{
+				ProxyProtocol: &ProxyProtocolOpt{
+					SourceAddr: "10.0.0.1:1234",
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(lis.Headers()).To(HaveLen(1))
+			Expect(lis.Headers()[0].SourceAddr).To(Equal("10.0.0.1:1234"))
+		})
+	})
+})
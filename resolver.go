@@ -0,0 +1,204 @@
+package gohc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ResolverOpt Describes how host names are resolved by a check instead of using system resolver implicitly.
+type ResolverOpt struct {
+	// Servers dns servers to query in turn as ip:port or ip (port default to 53).
+	// If left empty (default to servers of system configuration)
+	Servers []string
+	// Timeout for a resolution. If left empty (default to 5s)
+	Timeout time.Duration
+	// Family of addresses to use, addresses are tried in order until connection succeed. Default to IpFamilyAll
+	Family IpFamily
+	// Static addresses to use for host names instead of resolving them, like curl's --resolve
+	// (e.g.: {"api.example.com": {"10.0.0.1"}}). Names are case-insensitive.
+	Static map[string][]string
+}
+
+type resolver struct {
+	opt         *ResolverOpt
+	netResolver *net.Resolver
+	nextServer  uint32
+}
+
+// newResolver gives a resolver using system resolver if opt is nil
+func newResolver(opt *ResolverOpt) *resolver {
+	if opt == nil {
+		opt = &ResolverOpt{}
+	}
+	r := &resolver{
+		opt:         opt,
+		netResolver: net.DefaultResolver,
+	}
+	if len(opt.Servers) > 0 {
+		r.netResolver = &net.Resolver{
+			PreferGo: true,
+			Dial:     r.dialServer,
+		}
+	}
+	return r
+}
+
+// dialServer dials next dns server instead of the one from system configuration
+func (r *resolver) dialServer(ctx context.Context, network, _ string) (net.Conn, error) {
+	i := atomic.AddUint32(&r.nextServer, 1) - 1
+	server := r.opt.Servers[int(i)%len(r.opt.Servers)]
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, network, server)
+}
+
+// lookup gives ips of host filtered by family, resolution is reported to httptrace hooks from ctx if any.
+func (r *resolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ips, err := r.resolve(ctx, host)
+	if err == nil && len(ips) == 0 {
+		err = noIpFoundError(host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dns resolution of %s failed: %w", host, err)
+	}
+	return ips, nil
+}
+
+// lookupSrv gives SRV records of service
+func (r *resolver) lookupSrv(ctx context.Context, service, proto, name string) ([]*net.SRV, error) {
+	timeout := r.opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, srvs, err := r.netResolver.LookupSRV(ctx, service, proto, name)
+	return srvs, err
+}
+
+// noIpFoundError gives a dns error for host resolved without any ip usable
+func noIpFoundError(host string) error {
+	return &net.DNSError{Err: "no ip found", Name: host, IsNotFound: true}
+}
+
+// withDnsDuration gives ctx adding time spent resolving host names with it to duration
+func withDnsDuration(ctx context.Context, duration *time.Duration) context.Context {
+	var dnsStart time.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(_ httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(_ httptrace.DNSDoneInfo) {
+			*duration += time.Since(dnsStart)
+		},
+	})
+}
+
+func (r *resolver) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	for name, addrs := range r.opt.Static {
+		if !strings.EqualFold(name, host) {
+			continue
+		}
+		return r.resolveStatic(ctx, host, addrs)
+	}
+	timeout := r.opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := r.netResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return filterIps(ips, r.opt.Family), nil
+}
+
+// resolveStatic gives static addresses of host, net.Resolver reports other resolutions to httptrace hooks itself
+func (r *resolver) resolveStatic(ctx context.Context, host string, addrs []string) ([]net.IP, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	var ips []net.IP
+	var err error
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			ips = nil
+			err = fmt.Errorf("invalid static address '%s'", addr)
+			break
+		}
+		ips = append(ips, ip)
+	}
+	ips = filterIps(ips, r.opt.Family)
+	if trace != nil && trace.DNSDone != nil {
+		ipAddrs := make([]net.IPAddr, len(ips))
+		for i, ip := range ips {
+			ipAddrs[i] = net.IPAddr{IP: ip}
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: ipAddrs, Err: err})
+	}
+	return ips, err
+}
+
+// pinResolver gives a copy of opt resolving hostname to ip only
+func pinResolver(opt *ResolverOpt, hostname string, ip net.IP) *ResolverOpt {
+	pinned := &ResolverOpt{}
+	if opt != nil {
+		*pinned = *opt
+	}
+	pinned.Family = IpFamilyAll
+	pinned.Static = make(map[string][]string, len(pinned.Static)+1)
+	if opt != nil {
+		for name, addrs := range opt.Static {
+			if !strings.EqualFold(name, hostname) {
+				pinned.Static[name] = addrs
+			}
+		}
+	}
+	pinned.Static[hostname] = []string{ip.String()}
+	return pinned
+}
+
+// wrapDialResolver gives a dial function resolving host with resolver and trying its addresses in order
+func wrapDialResolver(r *resolver, dial dialContextFunc) dialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(network, "unix") {
+			return dial(ctx, network, addr)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+		ips, err := r.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	}
+}
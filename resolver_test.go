@@ -0,0 +1,144 @@
+package gohc_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	. "github.com/ArthurHlt/gohc"
+	"github.com/ArthurHlt/gohc/testhelpers"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"io"
+	"net"
+)
+
+var _ = Describe("Resolver", func() {
+	var dnsServer *testhelpers.DnsServer
+	var lis net.Listener
+	var port string
+	BeforeEach(func() {
+		var err error
+		dnsServer, err = testhelpers.NewDnsServer()
+		Expect(err).To(BeNil())
+		dnsServer.AddRecord("svc.gohc.test", "127.0.0.1")
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		_, port, _ = net.SplitHostPort(lis.Addr().String())
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			conn.Write([]byte("hello\n"))
+		})
+	})
+	AfterEach(func() {
+		dnsServer.Close()
+		lis.Close()
+	})
+	It("should resolve host with given dns servers", func() {
+		hc := NewTcpHealthCheck(&TcpOpt{
+			Resolver: &ResolverOpt{
+				Servers: []string{dnsServer.Addr()},
+			},
+			Receive: []*Payload{{Text: "hello"}},
+		})
+
+		result, err := hc.CheckWithResult("svc.gohc.test:" + port)
+		Expect(err).To(BeNil())
+		Expect(dnsServer.Queries()).To(BeNumerically(">", 0))
+		Expect(result.DnsDuration).To(BeNumerically(">", 0))
+	})
+	It("should use static addresses without querying dns servers", func() {
+		hc := NewTcpHealthCheck(&TcpOpt{
+			Resolver: &ResolverOpt{
+				Servers: []string{dnsServer.Addr()},
+				Static: map[string][]string{
+					"Backend.gohc.test": {"127.0.0.1"},
+				},
+			},
+			Receive: []*Payload{{Text: "hello"}},
+		})
+
+		err := hc.Check("backend.gohc.test:" + port)
+		Expect(err).To(BeNil())
+		Expect(dnsServer.Queries()).To(Equal(int64(0)))
+	})
+	It("should try next address when connection fails", func() {
+		hc := NewTcpHealthCheck(&TcpOpt{
+			Resolver: &ResolverOpt{
+				Static: map[string][]string{
+					"backend.gohc.test": {"127.0.0.2", "127.0.0.1"},
+				},
+			},
+			Receive: []*Payload{{Text: "hello"}},
+		})
+
+		err := hc.Check("backend.gohc.test:" + port)
+		Expect(err).To(BeNil())
+	})
+	It("should return a dns error when no address match family", func() {
+		hc := NewTcpHealthCheck(&TcpOpt{
+			Resolver: &ResolverOpt{
+				Servers: []string{dnsServer.Addr()},
+				Family:  IpFamilyV6,
+			},
+		})
+
+		err := hc.Check("svc.gohc.test:" + port)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("dns resolution of svc.gohc.test failed: lookup svc.gohc.test: no ip found"))
+		Expect(ClassifyError(err)).To(Equal(FailureClassDns))
+	})
+	It("should return a dns error when name does not exist", func() {
+		hc := NewTcpHealthCheck(&TcpOpt{
+			Resolver: &ResolverOpt{
+				Servers: []string{dnsServer.Addr()},
+			},
+		})
+
+		err := hc.Check("unknown.gohc.test:" + port)
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("dns resolution of unknown.gohc.test failed"))
+	})
+	It("should report dns duration and keep host name in http request", func() {
+		server := ghttp.NewServer()
+		defer server.Close()
+		server.AppendHandlers(ghttp.RespondWith(200, "OK"))
+		_, httpPort, _ := net.SplitHostPort(urlToHost(server.URL()))
+		hc := NewHttpHealthCheck(&HttpOpt{
+			Resolver: &ResolverOpt{
+				Servers: []string{dnsServer.Addr()},
+			},
+		})
+
+		result, err := hc.CheckWithResult("svc.gohc.test:" + httpPort)
+		Expect(err).To(BeNil())
+		Expect(result.DnsDuration).To(BeNumerically(">", 0))
+		Expect(server.ReceivedRequests()).To(HaveLen(1))
+		Expect(server.ReceivedRequests()[0].Host).To(Equal("svc.gohc.test:" + httpPort))
+	})
+	It("should check certificate of a name which does not resolve to host yet", func() {
+		cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+		Expect(err).To(BeNil())
+		tlsLis, err := net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		defer tlsLis.Close()
+		setConnHandlerListener(tlsLis, func(conn net.Conn) {
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			tlsConn.Handshake()
+			io.Copy(io.Discard, tlsConn)
+		})
+		_, tlsPort, _ := net.SplitHostPort(tlsLis.Addr().String())
+		rootCAs := x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(LocalhostCert)
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs: rootCAs,
+			Resolver: &ResolverOpt{
+				Static: map[string][]string{
+					"example.com": {"127.0.0.1"},
+				},
+			},
+		})
+
+		result, err := hc.CheckWithResult("example.com:" + tlsPort)
+		Expect(err).To(BeNil())
+		Expect(result.DnsDuration).To(BeNumerically(">", 0))
+	})
+})
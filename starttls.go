@@ -0,0 +1,344 @@
+package gohc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+type StartTlsProtocol int32
+
+const (
+	// StartTlsNone does not negotiate tls in-band (default behavior)
+	StartTlsNone StartTlsProtocol = 0
+	// StartTlsSmtp upgrades with EHLO then STARTTLS command (RFC 3207)
+	StartTlsSmtp StartTlsProtocol = 1
+	// StartTlsImap upgrades with STARTTLS command (RFC 2595)
+	StartTlsImap StartTlsProtocol = 2
+	// StartTlsPop3 upgrades with STLS command (RFC 2595)
+	StartTlsPop3 StartTlsProtocol = 3
+	// StartTlsFtp upgrades with AUTH TLS command (RFC 4217)
+	StartTlsFtp StartTlsProtocol = 4
+	// StartTlsLdap upgrades with StartTLS extended operation (RFC 4511)
+	StartTlsLdap StartTlsProtocol = 5
+	// StartTlsXmpp upgrades with starttls element in stream negotiation (RFC 6120)
+	StartTlsXmpp StartTlsProtocol = 6
+	// StartTlsPostgres upgrades with SSLRequest message
+	StartTlsPostgres StartTlsProtocol = 7
+)
+
+// Enum value maps for StartTlsProtocol.
+var (
+	StartTlsProtocol_name = map[int32]string{
+		0: "NONE",
+		1: "SMTP",
+		2: "IMAP",
+		3: "POP3",
+		4: "FTP",
+		5: "LDAP",
+		6: "XMPP",
+		7: "POSTGRES",
+	}
+	StartTlsProtocol_value = map[string]int32{
+		"NONE":     0,
+		"SMTP":     1,
+		"IMAP":     2,
+		"POP3":     3,
+		"FTP":      4,
+		"LDAP":     5,
+		"XMPP":     6,
+		"POSTGRES": 7,
+	}
+)
+
+const ldapStartTlsOid = "1.3.6.1.4.1.1466.20037"
+
+// startTls negotiates tls in-band on conn, domain is used by protocols which announce the server name.
+// After negotiation the connection is ready for tls handshake.
+func startTls(conn net.Conn, protocol StartTlsProtocol, domain string) error {
+	reader := bufio.NewReader(conn)
+	var err error
+	switch protocol {
+	case StartTlsSmtp:
+		err = startTlsSmtp(conn, reader)
+	case StartTlsImap:
+		err = startTlsImap(conn, reader)
+	case StartTlsPop3:
+		err = startTlsPop3(conn, reader)
+	case StartTlsFtp:
+		err = startTlsFtp(conn, reader)
+	case StartTlsLdap:
+		err = startTlsLdap(conn, reader)
+	case StartTlsXmpp:
+		err = startTlsXmpp(conn, reader, domain)
+	case StartTlsPostgres:
+		err = startTlsPostgres(conn, reader)
+	default:
+		err = fmt.Errorf("unknown protocol %d", protocol)
+	}
+	if err != nil {
+		return fmt.Errorf("%s starttls failed: %w", StartTlsProtocol_name[int32(protocol)], err)
+	}
+	// data sent before tls handshake could be injected by an attacker
+	if reader.Buffered() > 0 {
+		return fmt.Errorf("%s starttls failed: unexpected data received before tls handshake", StartTlsProtocol_name[int32(protocol)])
+	}
+	return nil
+}
+
+// readReplyCode reads a reply from a SMTP or FTP server, multiline replies are read until their last line.
+func readReplyCode(reader *bufio.Reader) (string, string, error) {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", strings.Join(lines, "\n"), err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+		if len(line) < 3 {
+			return "", strings.Join(lines, "\n"), fmt.Errorf("invalid reply '%s'", line)
+		}
+		if len(line) == 3 || line[3] == ' ' {
+			return line[:3], strings.Join(lines, "\n"), nil
+		}
+	}
+}
+
+func expectReplyCode(reader *bufio.Reader, expected string) error {
+	code, reply, err := readReplyCode(reader)
+	if err != nil {
+		return err
+	}
+	if code != expected {
+		return fmt.Errorf("expected reply code %s, got '%s'", expected, reply)
+	}
+	return nil
+}
+
+func startTlsSmtp(conn net.Conn, reader *bufio.Reader) error {
+	err := expectReplyCode(reader, "220")
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("EHLO gohc\r\n"))
+	if err != nil {
+		return err
+	}
+	err = expectReplyCode(reader, "250")
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("STARTTLS\r\n"))
+	if err != nil {
+		return err
+	}
+	return expectReplyCode(reader, "220")
+}
+
+func startTlsFtp(conn net.Conn, reader *bufio.Reader) error {
+	err := expectReplyCode(reader, "220")
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("AUTH TLS\r\n"))
+	if err != nil {
+		return err
+	}
+	return expectReplyCode(reader, "234")
+}
+
+func startTlsPop3(conn net.Conn, reader *bufio.Reader) error {
+	err := expectLinePrefix(reader, "+OK")
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("STLS\r\n"))
+	if err != nil {
+		return err
+	}
+	return expectLinePrefix(reader, "+OK")
+}
+
+func startTlsImap(conn net.Conn, reader *bufio.Reader) error {
+	err := expectLinePrefix(reader, "* OK")
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte("gohc STARTTLS\r\n"))
+	if err != nil {
+		return err
+	}
+	// untagged responses can be sent before tagged one
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "gohc ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "gohc OK") {
+			return fmt.Errorf("STARTTLS refused: '%s'", line)
+		}
+		return nil
+	}
+}
+
+func expectLinePrefix(reader *bufio.Reader, prefix string) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("expected '%s', got '%s'", prefix, line)
+	}
+	return nil
+}
+
+func startTlsXmpp(conn net.Conn, reader *bufio.Reader, domain string) error {
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", domain)
+	if err != nil {
+		return err
+	}
+	features, err := readUntilElement(reader, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, "urn:ietf:params:xml:ns:xmpp-tls") {
+		return fmt.Errorf("starttls not offered in stream features")
+	}
+	_, err = conn.Write([]byte("<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"))
+	if err != nil {
+		return err
+	}
+	resp, err := readUntilElement(reader, "/>")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(resp, "<proceed") {
+		return fmt.Errorf("STARTTLS refused: '%s'", resp)
+	}
+	return nil
+}
+
+// readUntilElement reads from reader byte by byte until end is found, data after end is not read.
+func readUntilElement(reader *bufio.Reader, end string) (string, error) {
+	var data []byte
+	for len(data) < defaultMaxReceiveBytes {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return string(data), err
+		}
+		data = append(data, b)
+		if bytes.HasSuffix(data, []byte(end)) {
+			return string(data), nil
+		}
+	}
+	return string(data), fmt.Errorf("max receive bytes %d reached", defaultMaxReceiveBytes)
+}
+
+func startTlsPostgres(conn net.Conn, reader *bufio.Reader) error {
+	// SSLRequest: length then request code 80877103
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], 80877103)
+	_, err := conn.Write(req)
+	if err != nil {
+		return err
+	}
+	resp, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	if resp != 'S' {
+		return fmt.Errorf("server does not accept ssl, got response '%c'", resp)
+	}
+	return nil
+}
+
+func startTlsLdap(conn net.Conn, reader *bufio.Reader) error {
+	// LDAPMessage { messageID 1, ExtendedRequest [APPLICATION 23] { requestName [0] oid } }
+	oid := []byte(ldapStartTlsOid)
+	extReq := append([]byte{0x80, byte(len(oid))}, oid...)
+	msg := append([]byte{0x02, 0x01, 0x01, 0x77, byte(len(extReq))}, extReq...)
+	_, err := conn.Write(append([]byte{0x30, byte(len(msg))}, msg...))
+	if err != nil {
+		return err
+	}
+
+	tag, content, err := readBerTlv(reader)
+	if err != nil {
+		return err
+	}
+	if tag != 0x30 {
+		return fmt.Errorf("invalid ldap response, expected sequence got tag 0x%x", tag)
+	}
+	contentReader := bufio.NewReader(bytes.NewReader(content))
+	// message id
+	_, _, err = readBerTlv(contentReader)
+	if err != nil {
+		return err
+	}
+	tag, extResp, err := readBerTlv(contentReader)
+	if err != nil {
+		return err
+	}
+	if tag != 0x78 {
+		return fmt.Errorf("invalid ldap response, expected extended response got tag 0x%x", tag)
+	}
+	tag, resultCode, err := readBerTlv(bufio.NewReader(bytes.NewReader(extResp)))
+	if err != nil {
+		return err
+	}
+	if tag != 0x0a || len(resultCode) != 1 {
+		return fmt.Errorf("invalid ldap response, no result code")
+	}
+	if resultCode[0] != 0 {
+		return fmt.Errorf("StartTLS refused with result code %d", resultCode[0])
+	}
+	return nil
+}
+
+// readBerTlv reads a BER tag, length and value, only single byte tags are supported.
+func readBerTlv(reader *bufio.Reader) (byte, []byte, error) {
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	lenByte, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(lenByte)
+	if lenByte&0x80 != 0 {
+		nbBytes := int(lenByte & 0x7f)
+		if nbBytes == 0 || nbBytes > 4 {
+			return 0, nil, fmt.Errorf("invalid ber length")
+		}
+		length = 0
+		for i := 0; i < nbBytes; i++ {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > defaultMaxReceiveBytes {
+		return 0, nil, fmt.Errorf("ber value too long")
+	}
+	value := make([]byte, length)
+	_, err = io.ReadFull(reader, value)
+	if err != nil {
+		return 0, nil, err
+	}
+	return tag, value, nil
+}
@@ -0,0 +1,203 @@
+package gohc_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net"
+	"strings"
+)
+
+// server side of starttls negotiation, returns false if tls must not be started
+type startTlsNegotiation func(conn net.Conn, reader *bufio.Reader) bool
+
+func readLine(reader *bufio.Reader) string {
+	line, _ := reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+var startTlsNegotiations = map[StartTlsProtocol]startTlsNegotiation{
+	StartTlsSmtp: func(conn net.Conn, reader *bufio.Reader) bool {
+		conn.Write([]byte("220-mail.example.com ESMTP\r\n220 ready\r\n"))
+		if !strings.HasPrefix(readLine(reader), "EHLO ") {
+			return false
+		}
+		conn.Write([]byte("250-mail.example.com\r\n250 STARTTLS\r\n"))
+		if readLine(reader) != "STARTTLS" {
+			return false
+		}
+		conn.Write([]byte("220 go ahead\r\n"))
+		return true
+	},
+	StartTlsImap: func(conn net.Conn, reader *bufio.Reader) bool {
+		conn.Write([]byte("* OK IMAP4rev1 ready\r\n"))
+		tag, cmd, _ := strings.Cut(readLine(reader), " ")
+		if cmd != "STARTTLS" {
+			return false
+		}
+		conn.Write([]byte("* CAPABILITY IMAP4rev1\r\n" + tag + " OK begin TLS\r\n"))
+		return true
+	},
+	StartTlsPop3: func(conn net.Conn, reader *bufio.Reader) bool {
+		conn.Write([]byte("+OK POP3 ready\r\n"))
+		if readLine(reader) != "STLS" {
+			return false
+		}
+		conn.Write([]byte("+OK begin TLS\r\n"))
+		return true
+	},
+	StartTlsFtp: func(conn net.Conn, reader *bufio.Reader) bool {
+		conn.Write([]byte("220 FTP ready\r\n"))
+		if readLine(reader) != "AUTH TLS" {
+			return false
+		}
+		conn.Write([]byte("234 AUTH TLS successful\r\n"))
+		return true
+	},
+	StartTlsLdap: func(conn net.Conn, reader *bufio.Reader) bool {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil || header[0] != 0x30 {
+			return false
+		}
+		msg := make([]byte, header[1])
+		if _, err := io.ReadFull(reader, msg); err != nil || !strings.Contains(string(msg), "1.3.6.1.4.1.1466.20037") {
+			return false
+		}
+		// ExtendedResponse with resultCode success
+		conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		return true
+	},
+	StartTlsXmpp: func(conn net.Conn, reader *bufio.Reader) bool {
+		stream, err := reader.ReadString('>')
+		if err != nil || !strings.Contains(stream, "<?xml") {
+			return false
+		}
+		stream, err = reader.ReadString('>')
+		if err != nil || !strings.Contains(stream, "to='127.0.0.1'") {
+			return false
+		}
+		conn.Write([]byte("<?xml version='1.0'?><stream:stream from='127.0.0.1' id='1' version='1.0' " +
+			"xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'><stream:features>" +
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>"))
+		starttls, err := reader.ReadString('>')
+		if err != nil || !strings.Contains(starttls, "<starttls") {
+			return false
+		}
+		conn.Write([]byte("<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"))
+		return true
+	},
+	StartTlsPostgres: func(conn net.Conn, reader *bufio.Reader) bool {
+		req := make([]byte, 8)
+		if _, err := io.ReadFull(reader, req); err != nil || binary.BigEndian.Uint32(req[4:]) != 80877103 {
+			return false
+		}
+		conn.Write([]byte("S"))
+		return true
+	},
+}
+
+var _ = Describe("StartTls", func() {
+	var lis net.Listener
+	var rootCAs *x509.CertPool
+	BeforeEach(func() {
+		var err error
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		rootCAs = x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(LocalhostCert)
+	})
+	AfterEach(func() {
+		lis.Close()
+	})
+	serveStartTls := func(negotiation startTlsNegotiation) {
+		cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+		Expect(err).To(BeNil())
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			reader := bufio.NewReader(conn)
+			if !negotiation(conn, reader) {
+				return
+			}
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			tlsConn.Write([]byte("hello over tls\n"))
+			tlsConn.Close()
+		})
+	}
+	for protocol := StartTlsSmtp; protocol <= StartTlsPostgres; protocol++ {
+		protocol, negotiation := protocol, startTlsNegotiations[protocol]
+		It("should upgrade connection with "+StartTlsProtocol_name[int32(protocol)]+" and verify certificate", func() {
+			serveStartTls(negotiation)
+			hc := NewTcpHealthCheck(&TcpOpt{
+				StartTls:  protocol,
+				TlsConfig: &tls.Config{RootCAs: rootCAs},
+				Receive:   []*Payload{{Text: "hello over tls"}},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+	}
+	It("should return an error when certificate is not trusted", func() {
+		serveStartTls(startTlsNegotiations[StartTlsSmtp])
+		hc := NewTcpHealthCheck(&TcpOpt{
+			StartTls: StartTlsSmtp,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("certificate"))
+	})
+	It("should return an error when server refuses upgrade", func() {
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			reader := bufio.NewReader(conn)
+			conn.Write([]byte("220 ready\r\n"))
+			readLine(reader)
+			conn.Write([]byte("250 mail.example.com\r\n"))
+			readLine(reader)
+			conn.Write([]byte("454 TLS not available\r\n"))
+		})
+		hc := NewTcpHealthCheck(&TcpOpt{
+			StartTls: StartTlsSmtp,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("SMTP starttls failed: expected reply code 220, got '454 TLS not available'"))
+	})
+	It("should return an error when data is injected before tls handshake", func() {
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			reader := bufio.NewReader(conn)
+			conn.Write([]byte("+OK ready\r\n"))
+			readLine(reader)
+			conn.Write([]byte("+OK begin TLS\r\ninjected\r\n"))
+			readLine(reader)
+		})
+		hc := NewTcpHealthCheck(&TcpOpt{
+			StartTls: StartTlsPop3,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("unexpected data received before tls handshake"))
+	})
+	It("should return an error when postgres does not accept ssl", func() {
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			io.ReadFull(conn, make([]byte, 8))
+			conn.Write([]byte("N"))
+		})
+		hc := NewTcpHealthCheck(&TcpOpt{
+			StartTls: StartTlsPostgres,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("server does not accept ssl"))
+	})
+})
@@ -0,0 +1,84 @@
+package gohc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type HealthStatus int
+
+const (
+	HealthStatusPass HealthStatus = iota
+	HealthStatusWarn
+	HealthStatusFail
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthStatusPass:
+		return "pass"
+	case HealthStatusWarn:
+		return "warn"
+	}
+	return "fail"
+}
+
+// WarnError is returned by a health check when the target answered correctly but in a degraded way
+// (e.g.: response slower than expected, program exited with nagios warning code).
+// It stays an error so callers not aware of warnings keep considering it as a failure,
+// use IsWarning or StatusFromError to distinguish it.
+type WarnError struct {
+	Err error
+}
+
+func NewWarnError(format string, a ...any) *WarnError {
+	return &WarnError{
+		Err: fmt.Errorf(format, a...),
+	}
+}
+
+func (e *WarnError) Error() string {
+	return "warning: " + e.Err.Error()
+}
+
+func (e *WarnError) Unwrap() error {
+	return e.Err
+}
+
+// IsWarning returns true if the error is (or wrap) a WarnError.
+func IsWarning(err error) bool {
+	var warnErr *WarnError
+	return errors.As(err, &warnErr)
+}
+
+// warnMessage gives message of a warning without its "warning: " prefix
+func warnMessage(err error) string {
+	var warnErr *WarnError
+	if errors.As(err, &warnErr) {
+		return warnErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// StatusFromError gives the health status corresponding to an error returned by a health check.
+func StatusFromError(err error) HealthStatus {
+	if err == nil {
+		return HealthStatusPass
+	}
+	if IsWarning(err) {
+		return HealthStatusWarn
+	}
+	return HealthStatusFail
+}
+
+func checkLatency(start time.Time, warnLatency time.Duration) error {
+	if warnLatency <= 0 {
+		return nil
+	}
+	elapsed := time.Since(start)
+	if elapsed > warnLatency {
+		return NewWarnError("check took %s, more than warning threshold %s", elapsed, warnLatency)
+	}
+	return nil
+}
@@ -1,13 +1,22 @@
 package gohc
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
-	"io"
 	"net"
+	"regexp"
 	"time"
 )
 
+// TcpResult gives details on a tcp check.
+type TcpResult struct {
+	// DnsDuration time spent resolving host, 0 if host is an ip
+	DnsDuration time.Duration
+	// Duration of the check
+	Duration time.Duration
+}
+
 // TcpOpt Describes the TCP health check specific options.
 type TcpOpt struct {
 	// TCP specific payload.
@@ -17,29 +26,93 @@ type TcpOpt struct {
 	// binary block must be found, and in the order specified, but not
 	// necessarily contiguous.
 	Receive []*Payload
-	// Timeout for connection and for each receive data. If left empty (default to 5s)
+	// Timeout for connection and for receiving all Receive payloads. If left empty (default to 5s)
 	Timeout time.Duration
+	// MaxReceiveBytes max number of bytes read to find Receive payloads or Expect of each script step.
+	// If left empty (default to 64KiB)
+	MaxReceiveBytes int64
+	// Script expect-style steps run in order after Send and Receive (e.g.: wait for banner, send command,
+	// expect reply).
+	Script []*TcpScriptStep
 	// TlsEnabled set to true if the gRPC health check request should be sent over TLS.
 	TlsEnabled bool
 	// TlsConfig specifies the TLS configuration to use for TLS enabled gRPC health check requests.
 	TlsConfig *tls.Config
+	// StartTls if set, tls is negotiated in-band with given protocol before tls handshake (e.g.: STARTTLS for SMTP),
+	// then Send, Receive and Script are run over the encrypted connection. Certificate is verified with TlsConfig.
+	StartTls StartTlsProtocol
 	// AltPort specifies the port to use for gRPC health check requests.
 	// If left empty it taks the port from host during check.
 	AltPort uint32
+	// Templated set to true to render Send and Receive text payloads as go templates with TemplateVars
+	// (e.g.: Send: "PING {{.Nonce}}\n", Receive: "PONG {{.Nonce}}").
+	Templated bool
+	// Proxy if set, connections are made through this proxy.
+	Proxy *ProxyOpt
+	// ProxyProtocol if set, a PROXY protocol header is sent at the beginning of each connection, before tls.
+	ProxyProtocol *ProxyProtocolOpt
+	// Network if set, describes source address, interface and socket options used by connections.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
+	// WarnLatency if set, a successful check taking more than this duration returns a WarnError.
+	WarnLatency time.Duration
 }
 
 type TcpHealthCheck struct {
-	opt *TcpOpt
+	opt           *TcpOpt
+	scriptRegexes []*regexp.Regexp
+	optErr        error
 }
 
 func NewTcpHealthCheck(opt *TcpOpt) *TcpHealthCheck {
+	scriptRegexes, err := makeTcpScriptRegexes(opt.Script)
 	return &TcpHealthCheck{
-		opt: opt,
+		opt:           opt,
+		scriptRegexes: scriptRegexes,
+		optErr:        err,
 	}
 }
 
 func (h *TcpHealthCheck) Check(host string) error {
-	netConn, err := h.makeNetConn(host)
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// CheckWithResult runs the check as Check does and gives details on the check.
+func (h *TcpHealthCheck) CheckWithResult(host string) (*TcpResult, error) {
+	start := time.Now()
+	result := &TcpResult{}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	return result, checkLatency(start, h.opt.WarnLatency)
+}
+
+func (h *TcpHealthCheck) check(host string, result *TcpResult) error {
+	if h.optErr != nil {
+		return h.optErr
+	}
+	var vars *TemplateVars
+	if h.opt.Templated || len(h.opt.Script) > 0 {
+		formattedHost, err := FormatHost(host, h.opt.AltPort)
+		if err != nil {
+			return err
+		}
+		// shared by payloads and script steps to send and expect the same nonce
+		vars, err = newTemplateVars(formattedHost)
+		if err != nil {
+			return err
+		}
+		vars.Captures = make(map[string]string)
+	}
+	send, receive, err := h.payloads(vars)
+	if err != nil {
+		return err
+	}
+	netConn, err := h.makeNetConn(host, &result.DnsDuration)
 	if err != nil {
 		return err
 	}
@@ -50,32 +123,80 @@ func (h *TcpHealthCheck) Check(host string) error {
 		timeout = 5 * time.Second
 	}
 
-	if h.opt.Send != nil {
-		_, err = netConn.Write(h.opt.Send.GetData())
+	if send != nil {
+		_, err = netConn.Write(send.GetData())
 		if err != nil {
 			return err
 		}
 	}
 
-	for _, toReceive := range h.opt.Receive {
-		err := netConn.SetReadDeadline(time.Now().Add(timeout))
-		if err != nil {
-			return err
+	maxBytes := h.opt.MaxReceiveBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxReceiveBytes
+	}
+	err = h.receive(netConn, receive, timeout, maxBytes)
+	if err != nil {
+		return err
+	}
+	if len(h.opt.Script) == 0 {
+		return nil
+	}
+	runner := &tcpScriptRunner{
+		conn:     netConn,
+		vars:     vars,
+		maxBytes: maxBytes,
+	}
+	return runner.run(h.opt.Script, h.scriptRegexes, timeout)
+}
+
+func (h *TcpHealthCheck) receive(netConn net.Conn, receive []*Payload, timeout time.Duration, maxBytes int64) error {
+	if len(receive) == 0 {
+		return nil
+	}
+	err := netConn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+	matcher := newReceiveMatcher(receive)
+	buf := make([]byte, 4096)
+	var received int64
+	for !matcher.done() {
+		if received >= maxBytes {
+			return matcher.err(fmt.Errorf("max receive bytes %d reached", maxBytes))
 		}
-		buf := make([]byte, len(toReceive.GetData()))
-		n, err := io.ReadFull(netConn, buf)
-		if err != nil {
-			return fmt.Errorf("failed to read %d bytes: %v", len(toReceive.GetData()), err)
+		readBuf := buf
+		if int64(len(readBuf)) > maxBytes-received {
+			readBuf = buf[:maxBytes-received]
 		}
-		got := buf[0:n]
-		if string(got) != string(toReceive.GetData()) {
-			return fmt.Errorf("expected %s, got %s", string(toReceive.GetData()), string(got))
+		n, err := netConn.Read(readBuf)
+		received += int64(n)
+		if matcher.feed(buf[:n]) {
+			return nil
+		}
+		if err != nil {
+			return matcher.err(err)
 		}
 	}
 	return nil
 }
 
-func (h *TcpHealthCheck) makeNetConn(host string) (net.Conn, error) {
+// payloads gives payloads to send and receive, rendered with vars if options are templated
+func (h *TcpHealthCheck) payloads(vars *TemplateVars) (*Payload, []*Payload, error) {
+	if !h.opt.Templated {
+		return h.opt.Send, h.opt.Receive, nil
+	}
+	send, err := vars.renderPayload(h.opt.Send)
+	if err != nil {
+		return nil, nil, err
+	}
+	receive, err := vars.renderPayloads(h.opt.Receive)
+	if err != nil {
+		return nil, nil, err
+	}
+	return send, receive, nil
+}
+
+func (h *TcpHealthCheck) makeNetConn(host string, dnsDuration *time.Duration) (net.Conn, error) {
 	var err error
 
 	timeout := h.opt.Timeout
@@ -90,10 +211,53 @@ func (h *TcpHealthCheck) makeNetConn(host string) (net.Conn, error) {
 	dialer := &net.Dialer{
 		Timeout: timeout,
 	}
-	if h.opt.TlsEnabled {
-		return tls.DialWithDialer(dialer, "tcp", host, h.opt.TlsConfig)
+	dial := makeNetworkDial(h.opt.Network, dialer)
+	if h.opt.Proxy != nil {
+		dial, err = makeProxyDial(h.opt.Proxy, dial)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return dialer.Dial("tcp", host)
+	if h.opt.Resolver != nil {
+		dial = wrapDialResolver(newResolver(h.opt.Resolver), dial)
+	}
+	if h.opt.ProxyProtocol != nil {
+		dial = wrapDialProxyProtocol(h.opt.ProxyProtocol, dial)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx = withDnsDuration(ctx, dnsDuration)
+	network, address := dialTarget(host)
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if !h.opt.TlsEnabled && h.opt.StartTls == StartTlsNone {
+		return conn, nil
+	}
+	tlsConf := tlsConfigForHost(h.opt.TlsConfig, defaultServerName(host))
+	if h.opt.StartTls != StartTlsNone {
+		conn.SetDeadline(time.Now().Add(timeout))
+		err = startTls(conn, h.opt.StartTls, tlsConf.ServerName)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	tlsConn := tls.Client(conn, tlsConf)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func (h *TcpHealthCheck) pinIp(hostname string, ip net.IP) HealthChecker {
+	opt := *h.opt
+	opt.Resolver = pinResolver(opt.Resolver, hostname, ip)
+	return NewTcpHealthCheck(&opt)
 }
 
 func (h *TcpHealthCheck) String() string {
@@ -0,0 +1,159 @@
+package gohc
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TcpScriptStep Describes a step of an expect-style script run on a TCP connection: Send is sent if set,
+// then received data must match Expect if set.
+type TcpScriptStep struct {
+	// Send payload to send, text payloads are go templates rendered with TemplateVars, values captured by
+	// previous steps are available in {{.Captures.<name>}} (e.g.: "RCPT TO:<{{.Captures.user}}>\r\n").
+	Send *Payload
+	// Expect regular expression that received data must match. Named groups are captured
+	// for later steps (e.g.: `^220 (?P<server>\S+)`).
+	// It is a go template rendered with TemplateVars as Send, values are quoted to match literally
+	// (e.g.: `^PONG {{.Nonce}}$`) except formatted Time.
+	Expect string
+	// LineMode set to true to match Expect on each received line (without line ending), lines are read
+	// until one matches. Otherwise, received data is buffered until it matches.
+	LineMode bool
+	// Timeout to find Expect in received data. If left empty (default to Timeout from TcpOpt)
+	Timeout time.Duration
+}
+
+func makeTcpScriptRegexes(steps []*TcpScriptStep) ([]*regexp.Regexp, error) {
+	regexes := make([]*regexp.Regexp, len(steps))
+	for i, step := range steps {
+		// templated expect is compiled once rendered
+		if step.Expect == "" || strings.Contains(step.Expect, "{{") {
+			continue
+		}
+		var err error
+		regexes[i], err = regexp.Compile(step.Expect)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expect regex for script step %d: %w", i+1, err)
+		}
+	}
+	return regexes, nil
+}
+
+// tcpScriptRunner runs script steps on a connection, data received after a match is kept for next steps
+type tcpScriptRunner struct {
+	conn     net.Conn
+	vars     *TemplateVars
+	maxBytes int64
+	pending  []byte
+}
+
+func (r *tcpScriptRunner) run(steps []*TcpScriptStep, regexes []*regexp.Regexp, timeout time.Duration) error {
+	for i, step := range steps {
+		err := r.runStep(step, regexes[i], timeout)
+		if err != nil {
+			return fmt.Errorf("script step %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r *tcpScriptRunner) runStep(step *TcpScriptStep, regex *regexp.Regexp, timeout time.Duration) error {
+	if step.Send != nil {
+		send, err := r.vars.renderPayload(step.Send)
+		if err != nil {
+			return err
+		}
+		_, err = r.conn.Write(send.GetData())
+		if err != nil {
+			return err
+		}
+	}
+	expect := step.Expect
+	if expect == "" {
+		return nil
+	}
+	if regex == nil {
+		var err error
+		expect, err = r.vars.quoted().render(step.Expect)
+		if err != nil {
+			return err
+		}
+		regex, err = regexp.Compile(expect)
+		if err != nil {
+			return fmt.Errorf("invalid expect regex: %w", err)
+		}
+	}
+	if step.Timeout > 0 {
+		timeout = step.Timeout
+	}
+	err := r.conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+	var match []int
+	var matched []byte
+	var received int64
+	// in line mode, position of the first line not yet searched
+	lineStart := 0
+	buf := make([]byte, 4096)
+	for {
+		matched, match = r.findMatch(regex, step.LineMode, &lineStart)
+		if match != nil {
+			break
+		}
+		if received >= r.maxBytes {
+			return fmt.Errorf("expected %s, got %q: max receive bytes %d reached", expect, r.pending, r.maxBytes)
+		}
+		n, err := r.conn.Read(buf)
+		received += int64(n)
+		r.pending = append(r.pending, buf[:n]...)
+		if err != nil {
+			// data received with error could still match
+			if matched, match = r.findMatch(regex, step.LineMode, &lineStart); match != nil {
+				break
+			}
+			return fmt.Errorf("expected %s, got %q: %v", expect, r.pending, err)
+		}
+	}
+	for i, name := range regex.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		r.vars.Captures[name] = string(matched[match[2*i]:match[2*i+1]])
+	}
+	return nil
+}
+
+// findMatch search regex in pending data and consumes data up to the match,
+// in line mode only complete lines from lineStart are searched and lineStart is moved after lines not matching.
+// It gives the data where the match was made and submatches indexes, nil indexes if no match.
+func (r *tcpScriptRunner) findMatch(regex *regexp.Regexp, lineMode bool, lineStart *int) ([]byte, []int) {
+	if !lineMode {
+		match := regex.FindSubmatchIndex(r.pending)
+		if match == nil {
+			return nil, nil
+		}
+		data := r.pending
+		r.pending = append([]byte(nil), r.pending[match[1]:]...)
+		return data, match
+	}
+	for {
+		end := bytes.IndexByte(r.pending[*lineStart:], '\n')
+		if end == -1 {
+			return nil, nil
+		}
+		end += *lineStart
+		line := bytes.TrimRight(r.pending[*lineStart:end], "\r")
+		*lineStart = end + 1
+		match := regex.FindSubmatchIndex(line)
+		if match != nil {
+			r.pending = append([]byte(nil), r.pending[end+1:]...)
+			*lineStart = 0
+			return line, match
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package gohc_test
 
 import (
+	"bufio"
+	"crypto/tls"
 	. "github.com/ArthurHlt/gohc"
 	"github.com/ArthurHlt/gohc/testhelpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync/atomic"
+	"time"
 )
 
 var _ = Describe("Tcp", func() {
@@ -58,6 +64,54 @@ var _ = Describe("Tcp", func() {
 			Expect(err).To(BeNil())
 			testhelpers.EventuallyAtomic(&ops).Should(Equal(1))
 		})
+		It("should check unix socket", func() {
+			unixLis, err := net.Listen("unix", filepath.Join(GinkgoT().TempDir(), "tcp.sock"))
+			Expect(err).To(BeNil())
+			defer unixLis.Close()
+			setConnHandlerListener(unixLis, func(conn net.Conn) {
+				conn.Write([]byte("test"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive: []*Payload{{Text: "test"}},
+			})
+
+			err = hc.Check(UnixHostPrefix + unixLis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should verify localhost certificate over tls on unix socket", func() {
+			cert, rootCAs, err := testhelpers.NewSelfSignedCert("localhost")
+			Expect(err).To(BeNil())
+			unixLis, err := net.Listen("unix", filepath.Join(GinkgoT().TempDir(), "tcp.sock"))
+			Expect(err).To(BeNil())
+			tlsLis := tls.NewListener(unixLis, &tls.Config{Certificates: []tls.Certificate{cert}})
+			defer tlsLis.Close()
+			setConnHandlerListener(tlsLis, func(conn net.Conn) {
+				conn.Write([]byte("test"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				TlsEnabled: true,
+				TlsConfig: &tls.Config{
+					RootCAs: rootCAs,
+				},
+				Receive: []*Payload{{Text: "test"}},
+			})
+
+			err = hc.Check(UnixHostPrefix + unixLis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should check abstract unix socket", func() {
+			if runtime.GOOS != "linux" {
+				Skip("abstract unix socket are only supported on linux")
+			}
+			unixLis, err := net.Listen("unix", "@gohc-test-abstract")
+			Expect(err).To(BeNil())
+			defer unixLis.Close()
+
+			hc := NewTcpHealthCheck(&TcpOpt{})
+
+			err = hc.Check(UnixHostPrefix + "@gohc-test-abstract")
+			Expect(err).To(BeNil())
+		})
 		It("should return nil if found payload", func() {
 			var ops int64
 			setConnHandlerListener(lis, func(conn net.Conn) {
@@ -108,5 +162,238 @@ var _ = Describe("Tcp", func() {
 			testhelpers.EventuallyAtomic(&ops).Should(Equal(1))
 			Expect(err).ToNot(BeNil())
 		})
+		It("should find blocks in order when they are not contiguous and split in several writes", func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("220 smtp.example.com "))
+				time.Sleep(50 * time.Millisecond)
+				conn.Write([]byte("ESMTP ready\r\n250-PIPE"))
+				time.Sleep(50 * time.Millisecond)
+				conn.Write([]byte("LINING\r\n"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive: []*Payload{
+					{Text: "220"},
+					{Text: "ESMTP"},
+					{Text: "PIPELINING"},
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should return error when blocks are not in order", func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("world hello"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive: []*Payload{
+					{Text: "hello"},
+					{Text: "world"},
+				},
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("expected world (block 2/2) in received data, got world hello"))
+		})
+		It("should return error when max receive bytes is reached", func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("0123456789 found"))
+				time.Sleep(time.Second)
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive:         []*Payload{{Text: "found"}},
+				MaxReceiveBytes: 10,
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("max receive bytes 10 reached"))
+		})
+		Context("Script", func() {
+			BeforeEach(func() {
+				setConnHandlerListener(lis, func(conn net.Conn) {
+					reader := bufio.NewReader(conn)
+					conn.Write([]byte("220 mail.example.com ESMTP token=abc42\r\n"))
+					for {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						switch strings.TrimSpace(line) {
+						case "EHLO gohc":
+							conn.Write([]byte("250-mail.example.com\r\n250-SIZE 1000\r\n"))
+							time.Sleep(50 * time.Millisecond)
+							conn.Write([]byte("250 PIPELINING\r\n"))
+						case "AUTH abc42":
+							conn.Write([]byte("235 authenticated\r\n"))
+						case "QUIT":
+							conn.Write([]byte("221 bye\r\n"))
+							return
+						default:
+							if strings.HasPrefix(line, "PING ") {
+								conn.Write([]byte(strings.Replace(line, "PING", "PONG", 1)))
+								continue
+							}
+							conn.Write([]byte("500 unknown command\r\n"))
+						}
+					}
+				})
+			})
+			It("should run send and expect steps with captures", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Script: []*TcpScriptStep{
+						{Expect: `^220 (?P<server>\S+) .*token=(?P<token>\w+)`, LineMode: true},
+						{Send: &Payload{Text: "EHLO gohc\r\n"}, Expect: `^250 PIPELINING$`, LineMode: true},
+						{Send: &Payload{Text: "AUTH {{.Captures.token}}\r\n"}, Expect: `235`},
+						{Send: &Payload{Text: "QUIT\r\n"}, Expect: `221`},
+					},
+				})
+
+				err := hc.Check(lis.Addr().String())
+				Expect(err).To(BeNil())
+			})
+			It("should name failing step and show received data", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Script: []*TcpScriptStep{
+						{Expect: `^220`, LineMode: true},
+						{Send: &Payload{Text: "AUTH wrong\r\n"}, Expect: `^235`, LineMode: true, Timeout: 200 * time.Millisecond},
+					},
+				})
+
+				err := hc.Check(lis.Addr().String())
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring(`script step 2 failed: expected ^235, got "500 unknown command\r\n"`))
+			})
+			It("should fail on step timeout", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Script: []*TcpScriptStep{
+						{Expect: `never sent`, Timeout: 100 * time.Millisecond},
+					},
+				})
+
+				start := time.Now()
+				err := hc.Check(lis.Addr().String())
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("script step 1 failed: expected never sent, got \"220 mail.example.com"))
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			})
+			It("should expect nonce sent by payload and previous steps", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Send:      &Payload{Text: "PING {{.Nonce}}\r\n"},
+					Templated: true,
+					Script: []*TcpScriptStep{
+						{Expect: `^PONG {{.Nonce}}$`, LineMode: true},
+						{Send: &Payload{Text: "PING {{.Nonce}}\r\n"}, Expect: `^PONG {{.Nonce}}$`, LineMode: true},
+					},
+				})
+
+				err := hc.Check(lis.Addr().String())
+				Expect(err).To(BeNil())
+			})
+			It("should fail when templated expect does not match", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Script: []*TcpScriptStep{
+						{Expect: `^220 (?P<server>\S+)`, LineMode: true},
+						{Send: &Payload{Text: "PING mail-example-com\r\n"}, Expect: `^PONG {{.Captures.server}}$`, LineMode: true, Timeout: 200 * time.Millisecond},
+					},
+				})
+
+				err := hc.Check(lis.Addr().String())
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring(`script step 2 failed: expected ^PONG mail\.example\.com$`))
+			})
+			It("should return an error when expect regex is invalid", func() {
+				hc := NewTcpHealthCheck(&TcpOpt{
+					Script: []*TcpScriptStep{
+						{Expect: `(`},
+					},
+				})
+
+				err := hc.Check(lis.Addr().String())
+				Expect(err).ToNot(BeNil())
+				Expect(err.Error()).To(ContainSubstring("invalid expect regex for script step 1"))
+			})
+		})
+		It("should send and expect nonce when templated", func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				buf := make([]byte, 64)
+				n, _ := conn.Read(buf)
+				conn.Write([]byte(strings.Replace(string(buf[:n]), "PING", "PONG", 1)))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Send:      &Payload{Text: "PING {{.Host}} {{.Nonce}}"},
+				Receive:   []*Payload{{Text: "PONG {{.Host}} {{.Nonce}}"}},
+				Templated: true,
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+		})
+		It("should fail when response is not fresh", func() {
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("PONG 0000000000000000"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Send:      &Payload{Text: "PING {{.Nonce}}"},
+				Receive:   []*Payload{{Text: "PONG {{.Nonce}}"}},
+				Templated: true,
+			})
+
+			err := hc.Check(lis.Addr().String())
+			Expect(err).ToNot(BeNil())
+		})
+		It("should check through socks5 proxy", func() {
+			proxyServer, err := testhelpers.NewSocks5Proxy("", "")
+			Expect(err).To(BeNil())
+			defer proxyServer.Close()
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("test"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive: []*Payload{{Text: "test"}},
+				Proxy: &ProxyOpt{
+					Url: "socks5://" + proxyServer.Addr(),
+				},
+			})
+
+			err = hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(proxyServer.Connections()).To(Equal(int64(1)))
+		})
+		It("should check through http connect proxy", func() {
+			proxyServer, err := testhelpers.NewHttpConnectProxy("", "")
+			Expect(err).To(BeNil())
+			defer proxyServer.Close()
+			setConnHandlerListener(lis, func(conn net.Conn) {
+				conn.Write([]byte("test"))
+			})
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Receive: []*Payload{{Text: "test"}},
+				Proxy: &ProxyOpt{
+					Url: "http://" + proxyServer.Addr(),
+				},
+			})
+
+			err = hc.Check(lis.Addr().String())
+			Expect(err).To(BeNil())
+			Expect(proxyServer.Connections()).To(Equal(int64(1)))
+		})
+		It("should return an error when proxy can not reach host", func() {
+			proxyServer, err := testhelpers.NewHttpConnectProxy("", "")
+			Expect(err).To(BeNil())
+			defer proxyServer.Close()
+			addr := lis.Addr().String()
+			lis.Close()
+			hc := NewTcpHealthCheck(&TcpOpt{
+				Proxy: &ProxyOpt{
+					Url: "http://" + proxyServer.Addr(),
+				},
+			})
+
+			err = hc.Check(addr)
+			Expect(err).ToNot(BeNil())
+			Expect(err.Error()).To(ContainSubstring("through proxy"))
+		})
 	})
 })
@@ -0,0 +1,136 @@
+package gohc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateVars Describes variables available in templated options (e.g.: `GET /health?from={{.Host}}&nonce={{.Nonce}}`).
+// Variables are computed once per check, the nonce sent is then the same as the one expected in received payloads,
+// which proves that response is fresh and not cached.
+type TemplateVars struct {
+	// Host checked without port, socket path for unix hosts
+	Host string
+	// Port checked, empty for unix hosts
+	Port string
+	// Timestamp unix timestamp in seconds at check start
+	Timestamp int64
+	// Time at check start, can be formatted (e.g.: {{.Time.Format "2006-01-02"}})
+	Time time.Time
+	// Nonce random hex string of 16 chars
+	Nonce string
+	// Captures values captured by extractors of previous steps in HttpScenarioHealthCheck (e.g.: {{.Captures.token}})
+	Captures map[string]string
+}
+
+func newTemplateVars(host string) (*TemplateVars, error) {
+	vars := &TemplateVars{
+		Time: time.Now(),
+	}
+	vars.Timestamp = vars.Time.Unix()
+	if IsUnixHost(host) {
+		_, vars.Host = dialTarget(host)
+	} else {
+		var err error
+		vars.Host, vars.Port, err = net.SplitHostPort(host)
+		if err != nil {
+			return nil, fmt.Errorf("fail to split host and port: %w", err)
+		}
+	}
+	nonce := make([]byte, 8)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("fail to generate nonce: %w", err)
+	}
+	vars.Nonce = hex.EncodeToString(nonce)
+	return vars, nil
+}
+
+// quoted gives a copy of vars with string values quoted to be used literally in regular expressions
+func (v *TemplateVars) quoted() *TemplateVars {
+	quoted := *v
+	quoted.Host = regexp.QuoteMeta(v.Host)
+	quoted.Port = regexp.QuoteMeta(v.Port)
+	quoted.Nonce = regexp.QuoteMeta(v.Nonce)
+	quoted.Captures = make(map[string]string, len(v.Captures))
+	for name, value := range v.Captures {
+		quoted.Captures[name] = regexp.QuoteMeta(value)
+	}
+	return &quoted
+}
+
+func (v *TemplateVars) render(text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template '%s': %w", text, err)
+	}
+	buf := &bytes.Buffer{}
+	err = tpl.Execute(buf, v)
+	if err != nil {
+		return "", fmt.Errorf("fail to render template '%s': %w", text, err)
+	}
+	return buf.String(), nil
+}
+
+// renderPayload renders text payload, binary payloads are kept as is
+func (v *TemplateVars) renderPayload(payload *Payload) (*Payload, error) {
+	if payload == nil || len(payload.Binary) > 0 {
+		return payload, nil
+	}
+	text, err := v.render(payload.Text)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{Text: text}, nil
+}
+
+func (v *TemplateVars) renderPayloads(payloads []*Payload) ([]*Payload, error) {
+	rendered := make([]*Payload, len(payloads))
+	for i, payload := range payloads {
+		var err error
+		rendered[i], err = v.renderPayload(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+func (v *TemplateVars) renderStrings(values []string) ([]string, error) {
+	rendered := make([]string, len(values))
+	for i, value := range values {
+		var err error
+		rendered[i], err = v.render(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// renderHeader renders header values, header names are kept as is
+func (v *TemplateVars) renderHeader(header http.Header) (http.Header, error) {
+	if header == nil {
+		return nil, nil
+	}
+	rendered := make(http.Header, len(header))
+	for key, values := range header {
+		var err error
+		rendered[key], err = v.renderStrings(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
@@ -0,0 +1,159 @@
+package testhelpers
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DnsServer is a minimal udp dns server answering A, AAAA and SRV questions from its records.
+type DnsServer struct {
+	conn       net.PacketConn
+	mu         sync.Mutex
+	records    map[string][]net.IP
+	srvRecords map[string][]*net.SRV
+	queries    int64
+}
+
+func NewDnsServer() (*DnsServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	d := &DnsServer{
+		conn:       conn,
+		records:    make(map[string][]net.IP),
+		srvRecords: make(map[string][]*net.SRV),
+	}
+	go d.serve()
+	return d, nil
+}
+
+// AddRecord adds addresses answered for name.
+func (d *DnsServer) AddRecord(name string, ips ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	for _, ip := range ips {
+		d.records[name] = append(d.records[name], net.ParseIP(ip))
+	}
+}
+
+// AddSrvRecord adds a SRV record answered for name (e.g.: _http._tcp.svc.gohc.test).
+func (d *DnsServer) AddSrvRecord(name string, srv *net.SRV) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	d.srvRecords[name] = append(d.srvRecords[name], srv)
+}
+
+func (d *DnsServer) Addr() string {
+	return d.conn.LocalAddr().String()
+}
+
+// Queries gives number of questions received.
+func (d *DnsServer) Queries() int64 {
+	return atomic.LoadInt64(&d.queries)
+}
+
+func (d *DnsServer) Close() {
+	d.conn.Close()
+}
+
+func (d *DnsServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		resp, err := d.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+		d.conn.WriteTo(resp, peer)
+	}
+}
+
+func (d *DnsServer) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&d.queries, 1)
+
+	d.mu.Lock()
+	ips, found := d.records[strings.ToLower(question.Name.String())]
+	srvs, srvFound := d.srvRecords[strings.ToLower(question.Name.String())]
+	d.mu.Unlock()
+	found = found || srvFound
+
+	header.Response = true
+	header.Authoritative = true
+	if !found {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	builder := dnsmessage.NewBuilder(nil, header)
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		resHeader := dnsmessage.ResourceHeader{
+			Name:  question.Name,
+			Type:  question.Type,
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		}
+		switch {
+		case question.Type == dnsmessage.TypeA && ip.To4() != nil:
+			res := dnsmessage.AResource{}
+			copy(res.A[:], ip.To4())
+			err = builder.AResource(resHeader, res)
+		case question.Type == dnsmessage.TypeAAAA && ip.To4() == nil:
+			res := dnsmessage.AAAAResource{}
+			copy(res.AAAA[:], ip.To16())
+			err = builder.AAAAResource(resHeader, res)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if question.Type != dnsmessage.TypeSRV {
+		return builder.Finish()
+	}
+	for _, srv := range srvs {
+		target, err := dnsmessage.NewName(strings.TrimSuffix(srv.Target, ".") + ".")
+		if err != nil {
+			return nil, err
+		}
+		err = builder.SRVResource(dnsmessage.ResourceHeader{
+			Name:  question.Name,
+			Type:  question.Type,
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		}, dnsmessage.SRVResource{
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+			Port:     srv.Port,
+			Target:   target,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
@@ -0,0 +1,167 @@
+package testhelpers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ProxyProtocolHeader is a PROXY protocol header received on a connection.
+type ProxyProtocolHeader struct {
+	Version int
+	// Family is TCP4, TCP6 or UNKNOWN
+	Family          string
+	SourceAddr      string
+	DestinationAddr string
+	Tlvs            map[byte][]byte
+}
+
+// ProxyProtocolListener wraps a listener to accept only connections starting with a PROXY protocol header,
+// header is removed from connection and recorded.
+type ProxyProtocolListener struct {
+	net.Listener
+	mu      sync.Mutex
+	headers []*ProxyProtocolHeader
+}
+
+func NewProxyProtocolListener(lis net.Listener) *ProxyProtocolListener {
+	return &ProxyProtocolListener{
+		Listener: lis,
+	}
+}
+
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		br := bufio.NewReader(conn)
+		header, err := readProxyProtocolHeader(br)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		conn.SetReadDeadline(time.Time{})
+		l.mu.Lock()
+		l.headers = append(l.headers, header)
+		l.mu.Unlock()
+		return &bufferedConn{Conn: conn, reader: br}, nil
+	}
+}
+
+// Headers gives headers received on accepted connections.
+func (l *ProxyProtocolListener) Headers() []*ProxyProtocolHeader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*ProxyProtocolHeader{}, l.headers...)
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func readProxyProtocolHeader(br *bufio.Reader) (*ProxyProtocolHeader, error) {
+	sig, err := br.Peek(len(proxyProtocolV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sig, proxyProtocolV2Signature) {
+		return readProxyProtocolV1Header(br)
+	}
+	return readProxyProtocolV2Header(br)
+}
+
+func readProxyProtocolV1Header(br *bufio.Reader) (*ProxyProtocolHeader, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("invalid v1 header")
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("invalid v1 header")
+	}
+	header := &ProxyProtocolHeader{
+		Version: 1,
+		Family:  fields[1],
+	}
+	if header.Family == "UNKNOWN" {
+		return header, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("invalid v1 header")
+	}
+	header.SourceAddr = net.JoinHostPort(fields[2], fields[4])
+	header.DestinationAddr = net.JoinHostPort(fields[3], fields[5])
+	return header, nil
+}
+
+func readProxyProtocolV2Header(br *bufio.Reader) (*ProxyProtocolHeader, error) {
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(br, fixed)
+	if err != nil {
+		return nil, err
+	}
+	if fixed[12] != 0x21 {
+		return nil, fmt.Errorf("invalid v2 version and command")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	_, err = io.ReadFull(br, payload)
+	if err != nil {
+		return nil, err
+	}
+	header := &ProxyProtocolHeader{
+		Version: 2,
+		Family:  "UNKNOWN",
+		Tlvs:    make(map[byte][]byte),
+	}
+	ipLen := 0
+	switch fixed[13] {
+	case 0x11:
+		header.Family = "TCP4"
+		ipLen = net.IPv4len
+	case 0x21:
+		header.Family = "TCP6"
+		ipLen = net.IPv6len
+	}
+	if ipLen > 0 {
+		if len(payload) < 2*ipLen+4 {
+			return nil, fmt.Errorf("invalid v2 address block")
+		}
+		srcPort := binary.BigEndian.Uint16(payload[2*ipLen:])
+		dstPort := binary.BigEndian.Uint16(payload[2*ipLen+2:])
+		header.SourceAddr = net.JoinHostPort(net.IP(payload[:ipLen]).String(), strconv.Itoa(int(srcPort)))
+		header.DestinationAddr = net.JoinHostPort(net.IP(payload[ipLen:2*ipLen]).String(), strconv.Itoa(int(dstPort)))
+		payload = payload[2*ipLen+4:]
+	}
+	for len(payload) > 0 {
+		if len(payload) < 3 {
+			return nil, fmt.Errorf("invalid v2 tlv")
+		}
+		length := int(binary.BigEndian.Uint16(payload[1:3]))
+		if len(payload) < 3+length {
+			return nil, fmt.Errorf("invalid v2 tlv")
+		}
+		header.Tlvs[payload[0]] = payload[3 : 3+length]
+		payload = payload[3+length:]
+	}
+	return header, nil
+}
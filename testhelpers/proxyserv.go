@@ -0,0 +1,209 @@
+package testhelpers
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ProxyServer is a minimal proxy handling either HTTP CONNECT or SOCKS5 (no auth or user/password auth).
+type ProxyServer struct {
+	lis      net.Listener
+	socks5   bool
+	user     string
+	password string
+
+	connections int64
+	mu          sync.Mutex
+	lastHeader  http.Header
+}
+
+func NewHttpConnectProxy(user, password string) (*ProxyServer, error) {
+	return newProxyServer(false, user, password)
+}
+
+func NewSocks5Proxy(user, password string) (*ProxyServer, error) {
+	return newProxyServer(true, user, password)
+}
+
+func newProxyServer(socks5 bool, user, password string) (*ProxyServer, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &ProxyServer{
+		lis:      lis,
+		socks5:   socks5,
+		user:     user,
+		password: password,
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go p.handle(conn)
+		}
+	}()
+	return p, nil
+}
+
+func (p *ProxyServer) Addr() string {
+	return p.lis.Addr().String()
+}
+
+// Connections gives number of tunnels successfully opened through proxy.
+func (p *ProxyServer) Connections() int64 {
+	return atomic.LoadInt64(&p.connections)
+}
+
+// LastHeader gives headers of last CONNECT request received.
+func (p *ProxyServer) LastHeader() http.Header {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastHeader
+}
+
+func (p *ProxyServer) Close() {
+	p.lis.Close()
+}
+
+func (p *ProxyServer) handle(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	var target string
+	var ok bool
+	if p.socks5 {
+		target, ok = p.socks5Handshake(br, conn)
+	} else {
+		target, ok = p.connectHandshake(br, conn)
+	}
+	if !ok {
+		return
+	}
+	targetConn, err := net.Dial("tcp", target)
+	if err != nil {
+		if p.socks5 {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		} else {
+			conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+		}
+		return
+	}
+	defer targetConn.Close()
+	if p.socks5 {
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	} else {
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	}
+	atomic.AddInt64(&p.connections, 1)
+	go func() {
+		io.Copy(targetConn, br)
+		targetConn.Close()
+	}()
+	io.Copy(conn, targetConn)
+}
+
+func (p *ProxyServer) connectHandshake(br *bufio.Reader, conn net.Conn) (string, bool) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return "", false
+	}
+	p.mu.Lock()
+	p.lastHeader = req.Header
+	p.mu.Unlock()
+	if req.Method != http.MethodConnect {
+		conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+		return "", false
+	}
+	if p.user != "" {
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.user+":"+p.password))
+		if req.Header.Get("Proxy-Authorization") != expected {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return "", false
+		}
+	}
+	return req.Host, true
+}
+
+func (p *ProxyServer) socks5Handshake(br *bufio.Reader, conn net.Conn) (string, bool) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil || header[0] != 5 {
+		return "", false
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return "", false
+	}
+	if p.user == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		// user/password sub negotiation (RFC 1929)
+		ver := make([]byte, 2)
+		if _, err := io.ReadFull(br, ver); err != nil {
+			return "", false
+		}
+		user := make([]byte, ver[1])
+		if _, err := io.ReadFull(br, user); err != nil {
+			return "", false
+		}
+		passLen, err := br.ReadByte()
+		if err != nil {
+			return "", false
+		}
+		password := make([]byte, passLen)
+		if _, err := io.ReadFull(br, password); err != nil {
+			return "", false
+		}
+		if string(user) != p.user || string(password) != p.password {
+			conn.Write([]byte{1, 1})
+			return "", false
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil || req[1] != 1 {
+		return "", false
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		addr := make([]byte, 4)
+		if _, err := io.ReadFull(br, addr); err != nil {
+			return "", false
+		}
+		host = net.IP(addr).String()
+	case 3:
+		nameLen, err := br.ReadByte()
+		if err != nil {
+			return "", false
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return "", false
+		}
+		host = string(name)
+	case 4:
+		addr := make([]byte, 16)
+		if _, err := io.ReadFull(br, addr); err != nil {
+			return "", false
+		}
+		host = net.IP(addr).String()
+	default:
+		return "", false
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(br, port); err != nil {
+		return "", false
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+}
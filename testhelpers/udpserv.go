@@ -2,11 +2,15 @@ package testhelpers
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
 type UdpServer struct {
+	// mu guards response, echo and handler set while server is running
+	mu       sync.Mutex
 	response []byte
+	echo     bool
 	handler  func([]byte)
 	conn     *net.UDPConn
 	done     chan struct{}
@@ -31,10 +35,21 @@ func NewUdpServer() (*UdpServer, error) {
 }
 
 func (u *UdpServer) SetResponse(response []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	u.response = response
 }
 
+// SetEcho set to true to respond with received data
+func (u *UdpServer) SetEcho(echo bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.echo = echo
+}
+
 func (u *UdpServer) SetHandler(handler func([]byte)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	u.handler = handler
 }
 
@@ -55,11 +70,17 @@ func (u *UdpServer) Run() error {
 		if err != nil {
 			continue
 		}
-		if u.handler != nil {
-			u.handler(buf[:n])
+		u.mu.Lock()
+		handler, response, echo := u.handler, u.response, u.echo
+		u.mu.Unlock()
+		if handler != nil {
+			handler(buf[:n])
+		}
+		if echo {
+			response = buf[:n]
 		}
-		if len(u.response) > 0 {
-			_, err = u.conn.WriteTo(u.response, addr)
+		if len(response) > 0 {
+			_, err = u.conn.WriteTo(response, addr)
 			if err != nil {
 				return err
 			}
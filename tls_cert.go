@@ -0,0 +1,331 @@
+package gohc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// TlsCertOpt Describes the policy to apply on tls certificates served by a host.
+type TlsCertOpt struct {
+	// ServerName sent in SNI and verified against certificate SAN. If left empty (default to host in check)
+	ServerName string
+	// RootCAs to verify certificate chain. If left empty (default to system roots)
+	RootCAs *x509.CertPool
+	// WarnDays a warning is returned when leaf certificate expires within this number of days. If left empty (default to 30)
+	WarnDays uint32
+	// FailDays check fails when leaf certificate expires within this number of days. If left empty (default to 7)
+	FailDays uint32
+	// SkipChainVerify set to true to not verify certificate chain against RootCAs.
+	SkipChainVerify bool
+	// SkipSanVerify set to true to not verify ServerName against certificate SAN.
+	SkipSanVerify bool
+	// MinRsaBits minimum size of rsa keys in served chain. If left empty (default to 2048)
+	MinRsaBits int
+	// MinEcdsaBits minimum size of ecdsa keys in served chain. If left empty (default to 256)
+	MinEcdsaBits int
+	// RequireOcspStapling set to true to fail when server does not staple an OCSP response.
+	RequireOcspStapling bool
+	// MinVersion minimum tls version accepted for negotiated version (e.g.: tls.VersionTLS12).
+	// If left empty any version is accepted.
+	MinVersion uint16
+	// CipherSuites accepted for negotiated cipher suite (e.g.: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).
+	// If left empty any cipher suite is accepted.
+	CipherSuites []uint16
+	// StartTls if set, tls is negotiated in-band with given protocol before tls handshake.
+	StartTls StartTlsProtocol
+	// Timeout for connection and handshake. If left empty (default to 5s)
+	Timeout time.Duration
+	// AltPort specifies the port to use for connection.
+	// If left empty it taks the port from host during check.
+	AltPort uint32
+	// Proxy if set, connections are made through this proxy.
+	Proxy *ProxyOpt
+	// Network if set, describes source address, interface and socket options used by connection.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
+}
+
+// TlsCertInfo gives details on a certificate served.
+type TlsCertInfo struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	DnsNames     []string
+	IpAddresses  []string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	// KeyType type of public key: RSA, ECDSA, Ed25519 or unknown
+	KeyType string
+	// KeyBits size of public key
+	KeyBits int
+}
+
+// TlsCertResult gives details on the tls connection and chain served.
+type TlsCertResult struct {
+	// Version negotiated (e.g.: tls.VersionTLS13)
+	Version uint16
+	// CipherSuite negotiated
+	CipherSuite uint16
+	// OcspStapled true if server stapled an OCSP response
+	OcspStapled bool
+	// Chain served by server, leaf first
+	Chain []*TlsCertInfo
+	// DaysBeforeExpiry of leaf certificate, negative if expired
+	DaysBeforeExpiry int
+	// DnsDuration time spent resolving host, 0 if host is an ip
+	DnsDuration time.Duration
+}
+
+type TlsCertHealthCheck struct {
+	opt *TlsCertOpt
+}
+
+func NewTlsCertHealthCheck(opt *TlsCertOpt) *TlsCertHealthCheck {
+	return &TlsCertHealthCheck{
+		opt: opt,
+	}
+}
+
+func (h *TlsCertHealthCheck) Check(host string) error {
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// CheckWithResult runs the check as Check does and gives details on the chain served,
+// result is nil if tls handshake could not be done.
+func (h *TlsCertHealthCheck) CheckWithResult(host string) (*TlsCertResult, error) {
+	host, err := FormatHost(host, h.opt.AltPort)
+	if err != nil {
+		return nil, err
+	}
+	state, dnsDuration, err := h.handshake(host)
+	if err != nil {
+		return nil, err
+	}
+	result := &TlsCertResult{
+		DnsDuration: dnsDuration,
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		OcspStapled: len(state.OCSPResponse) > 0,
+	}
+	if len(state.PeerCertificates) == 0 {
+		return result, fmt.Errorf("no certificate served")
+	}
+	for _, cert := range state.PeerCertificates {
+		result.Chain = append(result.Chain, makeTlsCertInfo(cert))
+	}
+	leaf := state.PeerCertificates[0]
+	result.DaysBeforeExpiry = int(time.Until(leaf.NotAfter).Hours() / 24)
+
+	var failures []string
+	var warnings []string
+	failures = append(failures, h.verifyCert(host, state)...)
+	failures = append(failures, h.verifyKeys(state.PeerCertificates)...)
+	failures = append(failures, h.verifyConnection(result)...)
+
+	warnDays := h.opt.WarnDays
+	if warnDays == 0 {
+		warnDays = 30
+	}
+	failDays := h.opt.FailDays
+	if failDays == 0 {
+		failDays = 7
+	}
+	switch {
+	case time.Now().After(leaf.NotAfter):
+		failures = append(failures, fmt.Sprintf("certificate expired on %s", leaf.NotAfter.Format(time.RFC3339)))
+	case result.DaysBeforeExpiry < int(failDays):
+		failures = append(failures, fmt.Sprintf("certificate expires in %d days, less than %d days", result.DaysBeforeExpiry, failDays))
+	case result.DaysBeforeExpiry < int(warnDays):
+		warnings = append(warnings, fmt.Sprintf("certificate expires in %d days, less than %d days", result.DaysBeforeExpiry, warnDays))
+	}
+
+	if len(failures) > 0 {
+		return result, fmt.Errorf("tls certificate check failed:\n%s", formatIssues(failures))
+	}
+	if len(warnings) > 0 {
+		return result, NewWarnError("tls certificate check:\n%s", formatIssues(warnings))
+	}
+	return result, nil
+}
+
+func (h *TlsCertHealthCheck) serverName(host string) string {
+	if h.opt.ServerName != "" {
+		return h.opt.ServerName
+	}
+	return defaultServerName(host)
+}
+
+func (h *TlsCertHealthCheck) handshake(host string) (*tls.ConnectionState, time.Duration, error) {
+	timeout := h.opt.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	dial := makeNetworkDial(h.opt.Network, dialer)
+	if h.opt.Proxy != nil {
+		var err error
+		dial, err = makeProxyDial(h.opt.Proxy, dial)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if h.opt.Resolver != nil {
+		dial = wrapDialResolver(newResolver(h.opt.Resolver), dial)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var dnsDuration time.Duration
+	ctx = withDnsDuration(ctx, &dnsDuration)
+	network, address := dialTarget(host)
+	conn, err := dial(ctx, network, address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	serverName := h.serverName(host)
+	if h.opt.StartTls != StartTlsNone {
+		conn.SetDeadline(time.Now().Add(timeout))
+		err = startTls(conn, h.opt.StartTls, serverName)
+		if err != nil {
+			return nil, 0, err
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: serverName,
+		// chain is verified after handshake to report all issues
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("tls handshake failed: %w", err)
+	}
+	state := tlsConn.ConnectionState()
+	return &state, dnsDuration, nil
+}
+
+func (h *TlsCertHealthCheck) verifyCert(host string, state *tls.ConnectionState) []string {
+	var failures []string
+	leaf := state.PeerCertificates[0]
+	if !h.opt.SkipChainVerify {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         h.opt.RootCAs,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("chain verification failed: %s", err))
+		}
+	}
+	if !h.opt.SkipSanVerify {
+		err := leaf.VerifyHostname(h.serverName(host))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("SAN verification failed: %s", err))
+		}
+	}
+	return failures
+}
+
+func (h *TlsCertHealthCheck) verifyKeys(certs []*x509.Certificate) []string {
+	minRsaBits := h.opt.MinRsaBits
+	if minRsaBits == 0 {
+		minRsaBits = 2048
+	}
+	minEcdsaBits := h.opt.MinEcdsaBits
+	if minEcdsaBits == 0 {
+		minEcdsaBits = 256
+	}
+	var failures []string
+	for _, cert := range certs {
+		info := makeTlsCertInfo(cert)
+		switch {
+		case info.KeyType == "RSA" && info.KeyBits < minRsaBits:
+			failures = append(failures, fmt.Sprintf("certificate '%s' has a %d bits RSA key, less than %d bits", info.Subject, info.KeyBits, minRsaBits))
+		case info.KeyType == "ECDSA" && info.KeyBits < minEcdsaBits:
+			failures = append(failures, fmt.Sprintf("certificate '%s' has a %d bits ECDSA key, less than %d bits", info.Subject, info.KeyBits, minEcdsaBits))
+		}
+	}
+	return failures
+}
+
+func (h *TlsCertHealthCheck) verifyConnection(result *TlsCertResult) []string {
+	var failures []string
+	if h.opt.RequireOcspStapling && !result.OcspStapled {
+		failures = append(failures, "OCSP stapling is missing")
+	}
+	if h.opt.MinVersion != 0 && result.Version < h.opt.MinVersion {
+		failures = append(failures, fmt.Sprintf("negotiated version %s is lower than %s",
+			tls.VersionName(result.Version), tls.VersionName(h.opt.MinVersion)))
+	}
+	if len(h.opt.CipherSuites) > 0 {
+		allowed := false
+		for _, cipherSuite := range h.opt.CipherSuites {
+			allowed = allowed || cipherSuite == result.CipherSuite
+		}
+		if !allowed {
+			failures = append(failures, fmt.Sprintf("negotiated cipher suite %s is not allowed", tls.CipherSuiteName(result.CipherSuite)))
+		}
+	}
+	return failures
+}
+
+func makeTlsCertInfo(cert *x509.Certificate) *TlsCertInfo {
+	info := &TlsCertInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		DnsNames:     cert.DNSNames,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		KeyType:      "unknown",
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IpAddresses = append(info.IpAddresses, ip.String())
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType = "RSA"
+		info.KeyBits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyType = "ECDSA"
+		info.KeyBits = key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyType = "Ed25519"
+		info.KeyBits = 256
+	}
+	return info
+}
+
+func formatIssues(issues []string) string {
+	var sb strings.Builder
+	for _, issue := range issues {
+		sb.WriteString(fmt.Sprintf("- %s\n", issue))
+	}
+	return sb.String()
+}
+
+func (h *TlsCertHealthCheck) pinIp(hostname string, ip net.IP) HealthChecker {
+	opt := *h.opt
+	opt.Resolver = pinResolver(opt.Resolver, hostname, ip)
+	return NewTlsCertHealthCheck(&opt)
+}
+
+func (h *TlsCertHealthCheck) String() string {
+	return "TlsCertHealthCheck"
+}
@@ -0,0 +1,152 @@
+package gohc_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	. "github.com/ArthurHlt/gohc"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net"
+)
+
+var _ = Describe("TlsCert", func() {
+	var lis net.Listener
+	var rootCAs *x509.CertPool
+	var serverConfig *tls.Config
+	BeforeEach(func() {
+		cert, err := tls.X509KeyPair(LocalhostCert, LocalhostKey)
+		Expect(err).To(BeNil())
+		serverConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}
+		rootCAs = x509.NewCertPool()
+		rootCAs.AppendCertsFromPEM(LocalhostCert)
+		lis, err = net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		setConnHandlerListener(lis, func(conn net.Conn) {
+			tlsConn := tls.Server(conn, serverConfig)
+			tlsConn.Handshake()
+			io.Copy(io.Discard, tlsConn)
+		})
+	})
+	AfterEach(func() {
+		lis.Close()
+	})
+	It("should pass and report chain when certificate follows policy", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs: rootCAs,
+		})
+
+		result, err := hc.CheckWithResult(lis.Addr().String())
+		Expect(err).To(BeNil())
+		Expect(result.Chain).To(HaveLen(1))
+		Expect(result.Chain[0].KeyType).To(Equal("RSA"))
+		Expect(result.Chain[0].KeyBits).To(Equal(2048))
+		Expect(result.Chain[0].DnsNames).To(ContainElement("example.com"))
+		Expect(result.Version).To(Equal(uint16(tls.VersionTLS13)))
+		Expect(result.DaysBeforeExpiry).To(BeNumerically(">", 30))
+	})
+	It("should fail when chain does not verify against roots", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs: x509.NewCertPool(),
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("chain verification failed"))
+	})
+	It("should fail when SAN does not match server name", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:    rootCAs,
+			ServerName: "other.com",
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("SAN verification failed"))
+		Expect(err.Error()).ToNot(ContainSubstring("chain verification failed"))
+	})
+	It("should warn when certificate expires within warn days", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:  rootCAs,
+			WarnDays: 100000,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(IsWarning(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("less than 100000 days"))
+	})
+	It("should fail when certificate expires within fail days", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:  rootCAs,
+			WarnDays: 100000,
+			FailDays: 90000,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(IsWarning(err)).To(BeFalse())
+		Expect(err.Error()).To(ContainSubstring("less than 90000 days"))
+	})
+	It("should fail when key is weaker than minimum", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:    rootCAs,
+			MinRsaBits: 4096,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("2048 bits RSA key, less than 4096 bits"))
+	})
+	It("should fail when OCSP stapling is required and missing", func() {
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:             rootCAs,
+			RequireOcspStapling: true,
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("OCSP stapling is missing"))
+	})
+	It("should pass when OCSP response is stapled", func() {
+		serverConfig.Certificates[0].OCSPStaple = []byte("ocsp-response")
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:             rootCAs,
+			RequireOcspStapling: true,
+		})
+
+		result, err := hc.CheckWithResult(lis.Addr().String())
+		Expect(err).To(BeNil())
+		Expect(result.OcspStapled).To(BeTrue())
+	})
+	It("should fail when negotiated version and cipher are below policy", func() {
+		serverConfig.MaxVersion = tls.VersionTLS12
+		serverConfig.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{
+			RootCAs:      rootCAs,
+			MinVersion:   tls.VersionTLS13,
+			CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		})
+
+		err := hc.Check(lis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(err.Error()).To(ContainSubstring("negotiated version TLS 1.2 is lower than TLS 1.3"))
+		Expect(err.Error()).To(ContainSubstring("negotiated cipher suite TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA is not allowed"))
+	})
+	It("should return an error when handshake fails", func() {
+		plainLis, err := net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		defer plainLis.Close()
+		setConnHandlerListener(plainLis, func(conn net.Conn) {
+			conn.Write([]byte("not tls\n"))
+		})
+		hc := NewTlsCertHealthCheck(&TlsCertOpt{})
+
+		result, err := hc.CheckWithResult(plainLis.Addr().String())
+		Expect(err).ToNot(BeNil())
+		Expect(result).To(BeNil())
+		Expect(err.Error()).To(ContainSubstring("tls handshake failed"))
+	})
+})
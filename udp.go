@@ -1,6 +1,7 @@
 package gohc
 
 import (
+	"context"
 	"fmt"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -23,6 +24,14 @@ var destUnCodeTxt = map[int]string{
 	5: "source route failed",
 }
 
+// UdpResult gives details on a udp check.
+type UdpResult struct {
+	// DnsDuration time spent resolving host, 0 if host is an ip
+	DnsDuration time.Duration
+	// Duration of the check
+	Duration time.Duration
+}
+
 type UdpOpt struct {
 	// Udp specific payload to send.
 	// If left empty (default to "test-gohc")
@@ -31,8 +40,10 @@ type UdpOpt struct {
 	// binary block must be found, and in the order specified, but not
 	// necessarily contiguous.
 	Receive []*Payload
-	// Timeout for port unreachable response or for each receive read deadline. If left empty (default to 5s)
+	// Timeout for port unreachable response or for receiving all Receive payloads. If left empty (default to 5s)
 	Timeout time.Duration
+	// MaxReceiveBytes max number of bytes read in datagrams to find Receive payloads. If left empty (default to 64KiB)
+	MaxReceiveBytes int64
 	// PingTimeout specifies the timeout for ICMP requests. If left empty (default to 5s)
 	PingTimeout time.Duration
 	// Delay specifies the delay between ICMP requests. If left empty (default to 1s)
@@ -40,6 +51,13 @@ type UdpOpt struct {
 	// AltPort specifies the port to use for gRPC health check requests.
 	// If left empty it taks the port from host during check.
 	AltPort uint32
+	// Templated set to true to render Send and Receive text payloads as go templates with TemplateVars
+	// (e.g.: Send: "PING {{.Nonce}}", Receive: "PONG {{.Nonce}}").
+	Templated bool
+	// Network if set, describes source address, interface and socket options used by udp and ICMP sockets.
+	Network *NetworkOpt
+	// Resolver if set, describes how host names are resolved instead of using system resolver.
+	Resolver *ResolverOpt
 }
 
 type UdpHealthCheck struct {
@@ -51,29 +69,91 @@ func NewUdpHealthCheck(opt *UdpOpt) *UdpHealthCheck {
 	return &UdpHealthCheck{
 		opt: opt,
 		icmpHc: NewIcmpHealthCheck(&IcmpOpt{
-			Timeout: opt.PingTimeout,
-			Delay:   opt.Delay,
+			Timeout:  opt.PingTimeout,
+			Delay:    opt.Delay,
+			Network:  opt.Network,
+			Resolver: opt.Resolver,
 		}),
 	}
 }
 
 func (h *UdpHealthCheck) Check(host string) error {
-	if len(h.opt.Receive) > 0 {
-		return h.checkWithReceive(host)
+	_, err := h.CheckWithResult(host)
+	return err
+}
+
+// CheckWithResult runs the check as Check does and gives details on the check.
+func (h *UdpHealthCheck) CheckWithResult(host string) (*UdpResult, error) {
+	start := time.Now()
+	result := &UdpResult{}
+	err := h.check(host, result)
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+func (h *UdpHealthCheck) check(host string, result *UdpResult) error {
+	send, receive, err := h.payloads(host)
+	if err != nil {
+		return err
 	}
-	return h.checkIcmpUdp(host)
+	if len(receive) > 0 {
+		return h.checkWithReceive(host, send, receive, result)
+	}
+	return h.checkIcmpUdp(host, send, result)
 }
 
-func (h *UdpHealthCheck) checkIcmpUdp(host string) error {
-	err := h.icmpHc.Check(host)
+// resolve gives host with the first address of its host name
+func (h *UdpHealthCheck) resolve(host string, result *UdpResult) (string, error) {
+	rawHost, port, err := net.SplitHostPort(host)
 	if err != nil {
-		return fmt.Errorf("icmp check failed: %w", err)
+		return "", err
+	}
+	ctx := withDnsDuration(context.Background(), &result.DnsDuration)
+	ips, err := newResolver(h.opt.Resolver).lookup(ctx, rawHost)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// payloads gives payloads to send and receive, rendered if options are templated
+func (h *UdpHealthCheck) payloads(host string) (*Payload, []*Payload, error) {
+	if !h.opt.Templated {
+		return h.opt.Send, h.opt.Receive, nil
+	}
+	host, err := FormatHost(host, h.opt.AltPort)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, err := newTemplateVars(host)
+	if err != nil {
+		return nil, nil, err
 	}
+	send, err := vars.renderPayload(h.opt.Send)
+	if err != nil {
+		return nil, nil, err
+	}
+	receive, err := vars.renderPayloads(h.opt.Receive)
+	if err != nil {
+		return nil, nil, err
+	}
+	return send, receive, nil
+}
 
-	host, err = FormatHost(host, h.opt.AltPort)
+func (h *UdpHealthCheck) checkIcmpUdp(host string, send *Payload, result *UdpResult) error {
+	host, err := FormatHost(host, h.opt.AltPort)
 	if err != nil {
 		return err
 	}
+	// ICMP messages are matched against ip
+	host, err = h.resolve(host, result)
+	if err != nil {
+		return err
+	}
+	err = h.icmpHc.Check(host)
+	if err != nil {
+		return fmt.Errorf("icmp check failed: %w", err)
+	}
 	rawHost, _, err := net.SplitHostPort(host)
 	if err != nil {
 		return err
@@ -85,11 +165,11 @@ func (h *UdpHealthCheck) checkIcmpUdp(host string) error {
 	}
 	defer conn.Close()
 
-	return h.pingIcmpUdp(conn, strings.Contains(rawHost, ":"), host)
+	return h.pingIcmpUdp(conn, strings.Contains(rawHost, ":"), host, send)
 
 }
 
-func (h *UdpHealthCheck) pingIcmpUdp(conn *icmp.PacketConn, isIpv6 bool, host string) error {
+func (h *UdpHealthCheck) pingIcmpUdp(conn net.PacketConn, isIpv6 bool, host string, sendPayload *Payload) error {
 	recv := make(chan *packet, 5)
 	done := make(chan struct{})
 	defer close(done)
@@ -108,11 +188,11 @@ func (h *UdpHealthCheck) pingIcmpUdp(conn *icmp.PacketConn, isIpv6 bool, host st
 		proto = protocolIPv6ICMP
 	}
 
-	connUdp, err := net.Dial("udp", host)
+	connUdp, err := makeNetworkDial(h.opt.Network, &net.Dialer{})(context.Background(), "udp", host)
 	if err != nil {
 		return err
 	}
-	send := h.opt.Send.GetData()
+	send := sendPayload.GetData()
 	if len(send) == 0 {
 		send = []byte(DefaultUdpSend)
 	}
@@ -170,7 +250,7 @@ func (h *UdpHealthCheck) pingIcmpUdp(conn *icmp.PacketConn, isIpv6 bool, host st
 	return errMess
 }
 
-func (h *UdpHealthCheck) listen(isIpv6 bool) (*icmp.PacketConn, error) {
+func (h *UdpHealthCheck) listen(isIpv6 bool) (net.PacketConn, error) {
 	timeout := h.opt.Timeout
 	if timeout == 0 {
 		timeout = 5 * time.Second
@@ -183,11 +263,11 @@ func (h *UdpHealthCheck) listen(isIpv6 bool) (*icmp.PacketConn, error) {
 		address = "::"
 	}
 
-	return icmp.ListenPacket(network, address)
+	return listenIcmp(h.opt.Network, network, address)
 }
 
 func (h *UdpHealthCheck) recvICMP(
-	conn *icmp.PacketConn,
+	conn net.PacketConn,
 	recv chan<- *packet,
 	done <-chan struct{},
 ) error {
@@ -224,24 +304,24 @@ func (h *UdpHealthCheck) recvICMP(
 	}
 }
 
-func (h *UdpHealthCheck) checkWithReceive(host string) error {
+func (h *UdpHealthCheck) checkWithReceive(host string, sendPayload *Payload, receive []*Payload, result *UdpResult) error {
 	timeout := h.opt.Timeout
 	if timeout == 0 {
 		timeout = 5 * time.Second
 	}
-	udpServer, err := net.ResolveUDPAddr("udp", host)
-
+	host, err := h.resolve(host, result)
 	if err != nil {
-		return fmt.Errorf("resolveUDPAddr failed: %s", err.Error())
+		return err
 	}
 
-	conn, err := net.DialUDP("udp", nil, udpServer)
+	dial := makeNetworkDial(h.opt.Network, &net.Dialer{})
+	conn, err := dial(context.Background(), "udp", host)
 	if err != nil {
 		return fmt.Errorf("listen failed: %s", err.Error())
 	}
 	defer conn.Close()
 
-	send := h.opt.Send.GetData()
+	send := sendPayload.GetData()
 	if len(send) == 0 {
 		send = []byte(DefaultUdpSend)
 	}
@@ -251,20 +331,28 @@ func (h *UdpHealthCheck) checkWithReceive(host string) error {
 		return err
 	}
 
-	for _, toReceive := range h.opt.Receive {
-		err := conn.SetReadDeadline(time.Now().Add(timeout))
-		if err != nil {
-			return err
+	err = conn.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return err
+	}
+	maxBytes := h.opt.MaxReceiveBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxReceiveBytes
+	}
+	// blocks are searched in the sequence of datagrams received
+	matcher := newReceiveMatcher(receive)
+	buf := make([]byte, 65535)
+	var received int64
+	for !matcher.done() {
+		if received >= maxBytes {
+			return matcher.err(fmt.Errorf("max receive bytes %d reached", maxBytes))
 		}
-		buf := make([]byte, len(toReceive.GetData()))
 		n, err := conn.Read(buf)
 		if err != nil {
-			return fmt.Errorf("failed to read %d bytes: %v", len(toReceive.GetData()), err)
-		}
-		got := buf[0:n]
-		if string(got) != string(toReceive.GetData()) {
-			return fmt.Errorf("expected %s, got %s", string(toReceive.GetData()), string(got))
+			return matcher.err(err)
 		}
+		received += int64(n)
+		matcher.feed(buf[:n])
 	}
 
 	return nil
@@ -4,6 +4,7 @@ import (
 	"github.com/ArthurHlt/gohc/testhelpers"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"net"
 	"os"
 	"sync/atomic"
 	"time"
@@ -62,12 +63,85 @@ var _ = Describe("Udp", func() {
 							Text: "received",
 						},
 					},
+					// datagrams are read until all payloads are found or timeout
+					Timeout: 500 * time.Millisecond,
 				})
 
 				err := hc.Check(udpServer.Addr())
 				Expect(err).To(HaveOccurred())
 				testhelpers.EventuallyAtomic(&ops).Should(Equal(1))
 			})
+			It("should find blocks in order when they are not contiguous", func() {
+				udpServer.SetResponse([]byte("status=ok; version=1.2; uptime=42"))
+
+				hc := NewUdpHealthCheck(&UdpOpt{
+					Receive: []*Payload{
+						{Text: "status=ok"},
+						{Text: "uptime="},
+					},
+				})
+
+				err := hc.Check(udpServer.Addr())
+				Expect(err).To(BeNil())
+			})
+			It("should find blocks across several datagrams", func() {
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+				Expect(err).To(BeNil())
+				defer conn.Close()
+				go func() {
+					buf := make([]byte, 1024)
+					_, addr, err := conn.ReadFrom(buf)
+					if err != nil {
+						return
+					}
+					conn.WriteTo([]byte("part1 hello"), addr)
+					conn.WriteTo([]byte("part2 world"), addr)
+				}()
+
+				hc := NewUdpHealthCheck(&UdpOpt{
+					Receive: []*Payload{
+						{Text: "hello"},
+						{Text: "world"},
+					},
+					Timeout: time.Second,
+				})
+
+				err = hc.Check(conn.LocalAddr().String())
+				Expect(err).To(BeNil())
+			})
+			It("should expect nonce sent when templated", func() {
+				var received atomic.Value
+				udpServer.SetHandler(func(b []byte) {
+					received.Store(string(b))
+				})
+				udpServer.SetEcho(true)
+
+				hc := NewUdpHealthCheck(&UdpOpt{
+					Send:      &Payload{Text: "ping {{.Port}} {{.Nonce}}"},
+					Receive:   []*Payload{{Text: "ping {{.Port}} {{.Nonce}}"}},
+					Templated: true,
+				})
+
+				err := hc.Check(udpServer.Addr())
+				Expect(err).To(BeNil())
+				Expect(received.Load()).To(MatchRegexp(`^ping \d+ [0-9a-f]{16}$`))
+			})
+			It("should resolve host name and report dns duration", func() {
+				udpServer.SetResponse([]byte("received"))
+				_, port, err := net.SplitHostPort(udpServer.Addr())
+				Expect(err).To(BeNil())
+
+				hc := NewUdpHealthCheck(&UdpOpt{
+					Receive: []*Payload{{Text: "received"}},
+					Resolver: &ResolverOpt{
+						Static: map[string][]string{"backend.gohc.test": {"127.0.0.1"}},
+					},
+				})
+
+				result, err := hc.CheckWithResult("backend.gohc.test:" + port)
+				Expect(err).To(BeNil())
+				Expect(result.DnsDuration).To(BeNumerically(">", 0))
+			})
 		})
 		When("No receive payload", func() {
 			BeforeEach(func() {